@@ -7,10 +7,13 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/HellfastUSMC/gophermart/internal/auth_tokens"
 	"github.com/HellfastUSMC/gophermart/internal/cashback_connector"
 	"github.com/HellfastUSMC/gophermart/internal/config"
 	"github.com/HellfastUSMC/gophermart/internal/controllers"
+	"github.com/HellfastUSMC/gophermart/internal/cred_policy"
 	"github.com/HellfastUSMC/gophermart/internal/database_connector"
+	"github.com/HellfastUSMC/gophermart/internal/notifier"
 	"github.com/HellfastUSMC/gophermart/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
@@ -22,23 +25,61 @@ func main() {
 	if err != nil {
 		log.Error().Err(err).Msg("config create error")
 	}
-	conn, err := dbconnector.NewConnectionSQL(conf.DBConnString, &log)
+	conn, err := dbconnector.NewConnectionSQL(conf.DBConnString, &log, conf.GetPointsTTL())
 	if err != nil {
 		log.Error().Err(err).Msg("DB connection error")
 		return
 	}
-	store := storage.NewStorage(&log, conn)
-	cbConn := cbconnector.NewCBConnector(&log, conf.CashbackAddr)
+	if conf.AdminLogin != "" {
+		rows, err := conn.SetUserRole(conf.AdminLogin, storage.RoleAdmin)
+		if err != nil || rows == 0 {
+			log.Error().Err(err).Msg(fmt.Sprintf("cannot grant admin role to %s", conf.AdminLogin))
+		}
+	}
+	var sessions storage.SessionStore = conn
+	if conf.SessionStorage == "memory" {
+		sessions = storage.NewMemSessionStore()
+	}
+	store := storage.NewStorage(&log, conn, sessions)
+	cbConn := cbconnector.NewCBConnector(&log, conf.CashbackAddr, int(conf.AccrualWorkers), int(conf.AccrualRate))
 	stat := storage.NewCurrentStats()
-	controller := controllers.NewGmartController(&log, conf, store, cbConn, stat)
+	var signer authtokens.Signer
+	if conf.TokenFormat == "jwt" {
+		signer, err = authtokens.NewSigner(conf.JWTAlg, conf.JWTKey)
+		if err != nil {
+			log.Error().Err(err).Msg("JWT signer create error")
+			return
+		}
+	}
+	notify, err := notifier.NewNotifier(conf.NotifierType, conf.NotifierFile, &log)
+	if err != nil {
+		log.Error().Err(err).Msg("notifier create error")
+		return
+	}
+	policy, err := credpolicy.NewPolicy(credpolicy.Options{
+		PasswordMinLength:   int(conf.PassMinLength),
+		PasswordClasses:     conf.PassClasses,
+		CommonPasswordsFile: conf.CommonPassFile,
+		LoginMinLength:      int(conf.LoginMinLength),
+		LoginMaxLength:      int(conf.LoginMaxLength),
+		LoginPattern:        conf.LoginPattern,
+		ReservedLogins:      conf.ReservedLogins,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("credentials policy create error")
+		return
+	}
+	controller := controllers.NewGmartController(&log, conf, store, cbConn, stat, signer, notify, policy)
 	tickCheckTokens := time.NewTicker(time.Duration(conf.TokensInterval) * time.Hour)
 	tickCheckCashback := time.NewTicker(time.Duration(conf.OrdersInterval) * time.Second)
 	tickCheckStats := time.NewTicker(time.Duration(conf.HealthInterval) * time.Hour)
+	tickExpirePoints := time.NewTicker(time.Duration(conf.ExpiryInterval) * time.Minute)
 	go func() {
 		defer runtime.Goexit()
 		for {
 			<-tickCheckTokens.C
 			controller.CheckTokens()
+			controller.CheckIdempotencyKeys()
 		}
 	}()
 	go func() {
@@ -48,19 +89,20 @@ func main() {
 			controller.CheckStatus()
 		}
 	}()
+	go func() {
+		defer runtime.Goexit()
+		for {
+			<-tickExpirePoints.C
+			controller.ExpirePoints()
+			controller.ReleaseExpiredHolds()
+			controller.ReconcileAccruals()
+		}
+	}()
 	go func() {
 		defer runtime.Goexit()
 		for {
 			<-tickCheckCashback.C
-			orders, err := controller.Storage.GetOrdersToCheck()
-			if err != nil {
-				log.Error().Err(err).Msg("error when get orders to update")
-			}
-			err = controller.Cashback.CheckOrders(orders, controller.Storage.UpdateOrder, controller.Storage.RegisterBonusChange)
-			if err != nil {
-				log.Error().Err(err).Msg("error when check orders")
-			}
-
+			controller.ProcessAccrualJobs()
 		}
 	}()
 	router := chi.NewRouter()
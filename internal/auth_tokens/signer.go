@@ -0,0 +1,163 @@
+package authtokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+type Claims struct {
+	Subject   string `json:"sub"`
+	ID        string `json:"jti"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type Signer interface {
+	Sign(claims Claims) (string, error)
+	Verify(token string) (Claims, error)
+}
+
+type HS256Signer struct {
+	Secret []byte
+}
+
+func (s *HS256Signer) Sign(claims Claims) (string, error) {
+	return sign(AlgHS256, claims, func(data []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	})
+}
+
+func (s *HS256Signer) Verify(token string) (Claims, error) {
+	return verify(AlgHS256, token, func(data []byte, signature []byte) bool {
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(data)
+		return hmac.Equal(signature, mac.Sum(nil))
+	})
+}
+
+type EdDSASigner struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+func (s *EdDSASigner) Sign(claims Claims) (string, error) {
+	return sign(AlgEdDSA, claims, func(data []byte) ([]byte, error) {
+		return ed25519.Sign(s.PrivateKey, data), nil
+	})
+}
+
+func (s *EdDSASigner) Verify(token string) (Claims, error) {
+	return verify(AlgEdDSA, token, func(data []byte, signature []byte) bool {
+		return ed25519.Verify(s.PublicKey, data, signature)
+	})
+}
+
+func sign(alg string, claims Claims, signFunc func(data []byte) ([]byte, error)) (string, error) {
+	headerJSON, err := json.Marshal(header{Alg: alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	data := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := signFunc([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func verify(alg string, token string, verifyFunc func(data []byte, signature []byte) bool) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	var head header
+	if err = json.Unmarshal(headerJSON, &head); err != nil || head.Alg != alg {
+		return claims, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if !verifyFunc([]byte(parts[0]+"."+parts[1]), signature) {
+		return claims, ErrInvalidToken
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err = json.Unmarshal(claimsJSON, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func GenerateToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+func NewSigner(alg string, key string) (Signer, error) {
+	if key == "" {
+		return nil, fmt.Errorf("no key provided for %s signer", alg)
+	}
+	switch alg {
+	case AlgHS256:
+		return &HS256Signer{Secret: []byte(key)}, nil
+	case AlgEdDSA:
+		seed, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("EdDSA key must be a base64 encoded %d bytes seed", ed25519.SeedSize)
+		}
+		privateKey := ed25519.NewKeyFromSeed(seed)
+		return &EdDSASigner{
+			PrivateKey: privateKey,
+			PublicKey:  privateKey.Public().(ed25519.PublicKey),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %s", alg)
+	}
+}
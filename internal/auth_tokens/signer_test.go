@@ -0,0 +1,143 @@
+package authtokens
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigners(t *testing.T) map[string]Signer {
+	t.Helper()
+	hs, err := NewSigner(AlgHS256, "secret")
+	if err != nil {
+		t.Fatalf("NewSigner(HS256) error = %v", err)
+	}
+	ed, err := NewSigner(AlgEdDSA, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("NewSigner(EdDSA) error = %v", err)
+	}
+	return map[string]Signer{AlgHS256: hs, AlgEdDSA: ed}
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		Subject:   "gopher",
+		ID:        "token-id",
+		SessionID: "session-id",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	for alg, signer := range testSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			claims := validClaims()
+			token, err := signer.Sign(claims)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			got, err := signer.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got != claims {
+				t.Errorf("Verify() = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestSignerRejectsExpiredToken(t *testing.T) {
+	for alg, signer := range testSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			claims := validClaims()
+			claims.ExpiresAt = time.Now().Add(-time.Second).Unix()
+			token, err := signer.Sign(claims)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if _, err = signer.Verify(token); !errors.Is(err, ErrTokenExpired) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrTokenExpired)
+			}
+		})
+	}
+}
+
+func TestSignerRejectsTamperedTokens(t *testing.T) {
+	signers := testSigners(t)
+	for alg, signer := range signers {
+		t.Run(alg, func(t *testing.T) {
+			token, err := signer.Sign(validClaims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			parts := strings.Split(token, ".")
+			forged := validClaims()
+			forged.Subject = "admin"
+			forgedToken, err := signer.Sign(forged)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			tampered := map[string]string{
+				"swapped claims": parts[0] + "." + strings.Split(forgedToken, ".")[1] + "." + parts[2],
+				"missing part":   parts[0] + "." + parts[1],
+				"bad signature":  parts[0] + "." + parts[1] + ".!!!",
+				"empty":          "",
+			}
+			for name, value := range tampered {
+				if _, err = signer.Verify(value); !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify(%s) error = %v, want %v", name, err, ErrInvalidToken)
+				}
+			}
+		})
+	}
+	hsToken, err := signers[AlgHS256].Sign(validClaims())
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err = signers[AlgEdDSA].Verify(hsToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("EdDSA Verify(HS256 token) error = %v, want %v", err, ErrInvalidToken)
+	}
+	other, _ := NewSigner(AlgHS256, "other secret")
+	if _, err = other.Verify(hsToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with other secret error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		alg  string
+		key  string
+	}{
+		{"empty key", AlgHS256, ""},
+		{"unknown alg", "RS256", "key"},
+		{"eddsa key not base64", AlgEdDSA, "not base64!"},
+		{"eddsa seed too short", AlgEdDSA, base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(tt.alg, tt.key); err == nil {
+				t.Error("NewSigner() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	first, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	second, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if len(first) != 64 || first == second {
+		t.Errorf("GenerateToken() = %q, %q, want distinct 64 hex chars", first, second)
+	}
+}
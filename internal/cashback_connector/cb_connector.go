@@ -3,19 +3,31 @@ package cbconnector
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/HellfastUSMC/gophermart/internal/logger"
 	"github.com/HellfastUSMC/gophermart/internal/storage"
 )
 
+const maxRateLimitRetries = 3
+
+type accrualResponse struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual json.Number `json:"accrual"`
+}
+
 type CBConnector struct {
-	CBPath string
-	Logger logger.Logger
+	CBPath  string
+	Logger  logger.Logger
+	Workers int
+	limiter *rateLimiter
 }
 
 func (c *CBConnector) CheckStatus() error {
@@ -51,8 +63,17 @@ func (c *CBConnector) CheckOrder(orderID string) (storage.Order, int, error) {
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("error in rows")
 	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		rateErr := newRateLimitError(response.Header, rBody, time.Now())
+		c.limiter.Pause(rateErr)
+		if err = response.Body.Close(); err != nil {
+			c.Logger.Error().Err(err).Msg("error in closing response body")
+		}
+		return order, response.StatusCode, rateErr
+	}
+	c.limiter.Success()
 	if response.StatusCode == http.StatusOK {
-		err = json.Unmarshal(rBody, &order)
+		order, err = decodeAccrual(rBody)
 		if err != nil {
 			c.Logger.Error().Err(err).Msg("error in unmarshal response body")
 			return order, response.StatusCode, err
@@ -66,47 +87,96 @@ func (c *CBConnector) CheckOrder(orderID string) (storage.Order, int, error) {
 	return order, response.StatusCode, nil
 }
 
+func decodeAccrual(body []byte) (storage.Order, error) {
+	var response accrualResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return storage.Order{}, err
+	}
+	order := storage.Order{ID: response.Order, Status: response.Status}
+	if response.Accrual != "" {
+		accrual, err := storage.RoundMoney(response.Accrual.String())
+		if err != nil {
+			return order, err
+		}
+		order.Accrual = accrual
+	}
+	return order, nil
+}
+
 func (c *CBConnector) CheckOrders(
 	orders []storage.Order,
-	updateOrderFunc func(id string, accrual float64, status string) (int64, error),
-	registerBonusChange func(orderID string, sum float64, placedAt string, login string, sub bool) (int64, error),
+	handleResult func(val storage.Order, order storage.Order, statusCode int, err error) error,
 ) error {
-	for _, val := range orders {
-		order, statusCode, err := c.CheckOrder(val.ID)
-		if err != nil {
-			c.Logger.Error().Err(err).Msg("cannot check order in CB service")
-			return err
-		}
-		if statusCode == http.StatusOK {
-			_, err = updateOrderFunc(val.ID, order.Accrual, order.Status)
-			c.Logger.Info().Msg(fmt.Sprintf("order %s updated with status %s", val.ID, order.Status))
-			if err != nil {
-				c.Logger.Error().Err(err).Msg("cannot update order to DB")
-				return err
-			}
-			if order.Status == "PROCESSED" {
-				_, err = registerBonusChange(val.ID, order.Accrual, val.Date, val.Login, false)
-				if err != nil {
-					c.Logger.Error().Err(err).Msg("cannot update bonuses to DB")
-					return err
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(orders) {
+		workers = len(orders)
+	}
+	jobs := make(chan storage.Order)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  int
+		lastErr error
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range jobs {
+				if err := c.checkOrder(order, handleResult); err != nil {
+					mu.Lock()
+					failed++
+					lastErr = err
+					mu.Unlock()
 				}
 			}
-		} else if statusCode == http.StatusNoContent {
-			_, err = updateOrderFunc(val.ID, val.Accrual, "INVALID")
-			if err != nil {
-				c.Logger.Error().Err(err).Msg("cannot update order to DB")
-				return err
-			}
-		} else {
-			return fmt.Errorf("CB service returned status %d", statusCode)
-		}
+		}()
+	}
+	for _, order := range orders {
+		jobs <- order
+	}
+	close(jobs)
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders failed to check, last error: %w", failed, len(orders), lastErr)
 	}
 	return nil
 }
 
-func NewCBConnector(logger logger.Logger, CBPath string) *CBConnector {
+func (c *CBConnector) checkOrder(
+	val storage.Order,
+	handleResult func(val storage.Order, order storage.Order, statusCode int, err error) error,
+) error {
+	var (
+		order      storage.Order
+		statusCode int
+		err        error
+	)
+	for attempt := 0; attempt < maxRateLimitRetries; attempt++ {
+		if err = c.limiter.Wait(context.Background()); err != nil {
+			break
+		}
+		order, statusCode, err = c.CheckOrder(val.ID)
+		var rateErr *RateLimitError
+		if !errors.As(err, &rateErr) {
+			break
+		}
+		c.Logger.Warn().Msg(fmt.Sprintf("%s, order %s will be retried, request interval is %s", rateErr, val.ID, c.limiter.Interval()))
+	}
+	if err != nil {
+		c.Logger.Error().Err(err).Msg(fmt.Sprintf("cannot check order %s in CB service", val.ID))
+	}
+	return handleResult(val, order, statusCode, err)
+}
+
+func NewCBConnector(logger logger.Logger, CBPath string, workers int, ratePerMinute int) *CBConnector {
 	return &CBConnector{
-		CBPath: CBPath,
-		Logger: logger,
+		CBPath:  CBPath,
+		Logger:  logger,
+		Workers: workers,
+		limiter: newRateLimiter(ratePerMinute),
 	}
 }
@@ -0,0 +1,33 @@
+package cbconnector
+
+import (
+	"testing"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func TestDecodeAccrual(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    storage.Order
+		wantErr bool
+	}{
+		{"processed", `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`, storage.Order{ID: "12345678903", Status: "PROCESSED", Accrual: 72998}, false},
+		{"extra precision", `{"order":"12345678903","status":"PROCESSED","accrual":729.987}`, storage.Order{ID: "12345678903", Status: "PROCESSED", Accrual: 72999}, false},
+		{"no accrual", `{"order":"12345678903","status":"REGISTERED"}`, storage.Order{ID: "12345678903", Status: "REGISTERED"}, false},
+		{"broken body", `{"order":`, storage.Order{}, true},
+		{"accrual not a number", `{"order":"12345678903","status":"PROCESSED","accrual":"many"}`, storage.Order{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAccrual([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeAccrual() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeAccrual() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
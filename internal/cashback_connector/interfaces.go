@@ -5,8 +5,7 @@ import "github.com/HellfastUSMC/gophermart/internal/storage"
 type Cashback interface {
 	CheckOrders(
 		orders []storage.Order,
-		updateOrderFunc func(id string, accrual float64, status string) (int64, error),
-		registerBonusChange func(orderID string, sum float64, placedAt string, login string, sub bool) (int64, error),
+		handleResult func(val storage.Order, order storage.Order, statusCode int, err error) error,
 	) error
 	CheckStatus() error
 	CheckOrder(orderID string) (storage.Order, int, error)
@@ -0,0 +1,131 @@
+package cbconnector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAfter  = 10 * time.Second
+	minRequestInterval = 10 * time.Millisecond
+	intervalDecay      = 16
+)
+
+var limitPattern = regexp.MustCompile(`(\d+)\s+requests?\s+per\s+minute`)
+
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Limit      int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("CB service rate limit of %d requests per minute reached, retry after %s", e.Limit, e.RetryAfter)
+}
+
+func newRateLimitError(header http.Header, body []byte, now time.Time) *RateLimitError {
+	rateErr := &RateLimitError{RetryAfter: defaultRetryAfter}
+	if raw := header.Get("Retry-After"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds >= 0 {
+			rateErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(raw); err == nil && at.After(now) {
+			rateErr.RetryAfter = at.Sub(now)
+		}
+	}
+	if match := limitPattern.FindSubmatch(body); match != nil {
+		rateErr.Limit, _ = strconv.Atoi(string(match[1]))
+	}
+	return rateErr
+}
+
+type rateLimiter struct {
+	mu          sync.Mutex
+	base        time.Duration
+	interval    time.Duration
+	next        time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	limiter := &rateLimiter{}
+	if perMinute > 0 {
+		limiter.base = time.Minute / time.Duration(perMinute)
+		limiter.interval = limiter.base
+	}
+	return limiter
+}
+
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		start := now
+		if l.pausedUntil.After(start) {
+			start = l.pausedUntil
+		}
+		if l.next.After(start) {
+			start = l.next
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+		delay := start.Sub(now)
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		l.mu.Lock()
+		paused := l.pausedUntil.After(time.Now())
+		l.mu.Unlock()
+		if !paused {
+			return nil
+		}
+	}
+}
+
+func (l *rateLimiter) Success() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interval <= l.base {
+		return
+	}
+	l.interval -= l.interval / intervalDecay
+	if l.interval < l.base {
+		l.interval = l.base
+	}
+	if l.base == 0 && l.interval < minRequestInterval {
+		l.interval = 0
+	}
+}
+
+func (l *rateLimiter) Pause(rateErr *RateLimitError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(rateErr.RetryAfter)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	switch {
+	case rateErr.Limit > 0:
+		l.interval = time.Minute / time.Duration(rateErr.Limit)
+	case l.interval < minRequestInterval:
+		l.interval = minRequestInterval
+	default:
+		l.interval *= 2
+	}
+}
+
+func (l *rateLimiter) Interval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.interval
+}
@@ -0,0 +1,113 @@
+package cbconnector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimitError(t *testing.T) {
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter string
+		body       string
+		wantAfter  time.Duration
+		wantLimit  int
+	}{
+		{"seconds and limit", "60", "No more than 20 requests per minute allowed", time.Minute, 20},
+		{"http date", now.Add(30 * time.Second).Format(http.TimeFormat), "", 30 * time.Second, 0},
+		{"missing header", "", "1 request per minute", defaultRetryAfter, 1},
+		{"garbage header", "soon", "", defaultRetryAfter, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			rateErr := newRateLimitError(header, []byte(tt.body), now)
+			if rateErr.RetryAfter != tt.wantAfter {
+				t.Errorf("RetryAfter = %s, want %s", rateErr.RetryAfter, tt.wantAfter)
+			}
+			if rateErr.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", rateErr.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestRateLimiterPauseAdaptsInterval(t *testing.T) {
+	limiter := newRateLimiter(0)
+	limiter.Pause(&RateLimitError{})
+	if got := limiter.Interval(); got != minRequestInterval {
+		t.Fatalf("interval after first 429 = %s, want %s", got, minRequestInterval)
+	}
+	limiter.Pause(&RateLimitError{})
+	if got := limiter.Interval(); got != 2*minRequestInterval {
+		t.Fatalf("interval after second 429 = %s, want %s", got, 2*minRequestInterval)
+	}
+	limiter.Pause(&RateLimitError{Limit: 120})
+	if got := limiter.Interval(); got != 500*time.Millisecond {
+		t.Fatalf("interval after announced limit = %s, want 500ms", got)
+	}
+}
+
+func TestRateLimiterSuccessDecaysToConfiguredRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		want      time.Duration
+	}{
+		{"configured rate", 600, 100 * time.Millisecond},
+		{"unlimited", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.perMinute)
+			limiter.Pause(&RateLimitError{Limit: 6})
+			if got := limiter.Interval(); got != 10*time.Second {
+				t.Fatalf("interval after 429 = %s, want 10s", got)
+			}
+			limiter.Success()
+			if got := limiter.Interval(); got >= 10*time.Second {
+				t.Fatalf("interval did not decay after success: %s", got)
+			}
+			for i := 0; i < 1000; i++ {
+				limiter.Success()
+			}
+			if got := limiter.Interval(); got != tt.want {
+				t.Errorf("interval after successes = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWaitHonoursExtendedPause(t *testing.T) {
+	limiter := newRateLimiter(0)
+	limiter.Pause(&RateLimitError{RetryAfter: 30 * time.Millisecond})
+	start := time.Now()
+	done := make(chan time.Duration)
+	go func() {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Errorf("Wait() error = %v", err)
+		}
+		done <- time.Since(start)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	limiter.Pause(&RateLimitError{RetryAfter: 100 * time.Millisecond})
+	if waited := <-done; waited < 100*time.Millisecond {
+		t.Errorf("Wait() returned after %s, before the extended pause ended", waited)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	limiter := newRateLimiter(0)
+	limiter.Pause(&RateLimitError{RetryAfter: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
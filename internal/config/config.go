@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -14,6 +15,58 @@ type SysConfig struct {
 	TokensInterval int64  `env:"T_INTERVAL"`
 	HealthInterval int64  `env:"H_INTERVAL"`
 	OrdersInterval int64  `env:"O_INTERVAL"`
+	SessionStorage string `env:"SESSION_STORAGE"`
+	TokenFormat    string `env:"TOKEN_FORMAT"`
+	JWTAlg         string `env:"JWT_ALG"`
+	JWTKey         string `env:"JWT_KEY"`
+	AccessTTL      int64  `env:"ACCESS_TTL"`
+	RefreshTTL     int64  `env:"REFRESH_TTL"`
+	LoginFailures  int64  `env:"LOGIN_MAX_FAILURES"`
+	IPFailures     int64  `env:"IP_MAX_FAILURES"`
+	LoginBackoff   int64  `env:"LOGIN_BACKOFF"`
+	LoginLockout   int64  `env:"LOGIN_LOCKOUT"`
+	ResetTTL       int64  `env:"RESET_TTL"`
+	NotifierType   string `env:"NOTIFIER"`
+	NotifierFile   string `env:"NOTIFIER_FILE"`
+	PassMinLength  int64  `env:"PASSWORD_MIN_LENGTH"`
+	PassClasses    string `env:"PASSWORD_CLASSES"`
+	CommonPassFile string `env:"COMMON_PASSWORDS_FILE"`
+	LoginMinLength int64  `env:"LOGIN_MIN_LENGTH"`
+	LoginMaxLength int64  `env:"LOGIN_MAX_LENGTH"`
+	LoginPattern   string `env:"LOGIN_PATTERN"`
+	ReservedLogins string `env:"RESERVED_LOGINS"`
+	AdminLogin     string `env:"ADMIN_LOGIN"`
+	IdempotencyTTL int64  `env:"IDEMPOTENCY_TTL"`
+	WithdrawMaxSum int64  `env:"WITHDRAW_MAX_SUM"`
+	WithdrawDaily  int64  `env:"WITHDRAW_DAILY_LIMIT"`
+	ServiceToken   string `env:"SERVICE_TOKEN"`
+	PointsTTL      int64  `env:"POINTS_TTL"`
+	ExpiryInterval int64  `env:"E_INTERVAL"`
+	ExpiryNotice   int64  `env:"EXPIRY_NOTICE"`
+	HoldTTL        int64  `env:"HOLD_TTL"`
+	AccrualWorkers int64  `env:"ACCRUAL_WORKERS"`
+	AccrualRate    int64  `env:"ACCRUAL_RATE"`
+	AccrualBackoff int64  `env:"ACCRUAL_BACKOFF"`
+	AccrualMaxWait int64  `env:"ACCRUAL_MAX_BACKOFF"`
+	AccrualMaxAge  int64  `env:"ACCRUAL_MAX_AGE"`
+}
+
+type AccrualJobPolicy struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	MaxAge     time.Duration
+}
+
+type WithdrawLimits struct {
+	MaxSum     int64
+	DailyLimit int64
+}
+
+type LoginLimits struct {
+	MaxLoginFailures int64
+	MaxIPFailures    int64
+	Backoff          time.Duration
+	Lockout          time.Duration
 }
 
 func (c *SysConfig) ParseStartupFlags() error {
@@ -54,6 +107,210 @@ func (c *SysConfig) ParseStartupFlags() error {
 		1,
 		"Orders check interval in seconds int64",
 	)
+	serverFlags.StringVar(
+		&c.SessionStorage,
+		"ss",
+		"db",
+		"Sessions storage type string (db or memory)",
+	)
+	serverFlags.StringVar(
+		&c.TokenFormat,
+		"tf",
+		"opaque",
+		"Access tokens format string (opaque or jwt)",
+	)
+	serverFlags.StringVar(
+		&c.JWTAlg,
+		"ja",
+		"HS256",
+		"JWT signing algorithm string (HS256 or EdDSA)",
+	)
+	serverFlags.StringVar(
+		&c.JWTKey,
+		"jk",
+		"",
+		"JWT signing key string (HS256 secret or base64 EdDSA seed)",
+	)
+	serverFlags.Int64Var(
+		&c.AccessTTL,
+		"at",
+		15,
+		"JWT access tokens TTL in minutes int64",
+	)
+	serverFlags.Int64Var(
+		&c.RefreshTTL,
+		"rt",
+		720,
+		"Refresh tokens TTL in hours int64",
+	)
+	serverFlags.Int64Var(
+		&c.LoginFailures,
+		"lf",
+		5,
+		"Failed logins before account lockout int64",
+	)
+	serverFlags.Int64Var(
+		&c.IPFailures,
+		"if",
+		20,
+		"Failed logins from one IP before it is throttled int64",
+	)
+	serverFlags.Int64Var(
+		&c.LoginBackoff,
+		"lb",
+		1,
+		"Base backoff after failed login in seconds int64",
+	)
+	serverFlags.Int64Var(
+		&c.LoginLockout,
+		"ll",
+		15,
+		"Lockout after too many failed logins in minutes int64",
+	)
+	serverFlags.Int64Var(
+		&c.ResetTTL,
+		"pt",
+		30,
+		"Password reset tokens TTL in minutes int64",
+	)
+	serverFlags.StringVar(
+		&c.NotifierType,
+		"n",
+		"log",
+		"Notifier type string (log or file)",
+	)
+	serverFlags.StringVar(
+		&c.NotifierFile,
+		"nf",
+		"password_resets.log",
+		"Notifier output file path string",
+	)
+	serverFlags.Int64Var(
+		&c.PassMinLength,
+		"pml",
+		8,
+		"Minimal password length int64",
+	)
+	serverFlags.StringVar(
+		&c.PassClasses,
+		"pc",
+		"",
+		"Required password character classes string (comma separated lower, upper, digit, special)",
+	)
+	serverFlags.StringVar(
+		&c.CommonPassFile,
+		"cpf",
+		"",
+		"Path to file with common passwords list string",
+	)
+	serverFlags.Int64Var(
+		&c.LoginMinLength,
+		"lml",
+		3,
+		"Minimal login length int64",
+	)
+	serverFlags.Int64Var(
+		&c.LoginMaxLength,
+		"lxl",
+		64,
+		"Maximal login length int64",
+	)
+	serverFlags.StringVar(
+		&c.LoginPattern,
+		"lp",
+		`^[a-zA-Z0-9._@-]+$`,
+		"Login allowed characters regexp string",
+	)
+	serverFlags.StringVar(
+		&c.ReservedLogins,
+		"rl",
+		"admin,root,support,system",
+		"Reserved logins string (comma separated)",
+	)
+	serverFlags.StringVar(
+		&c.AdminLogin,
+		"al",
+		"",
+		"Login of existing user to grant admin role on startup string",
+	)
+	serverFlags.Int64Var(
+		&c.IdempotencyTTL,
+		"it",
+		24,
+		"Idempotency keys TTL in hours int64",
+	)
+	serverFlags.Int64Var(
+		&c.WithdrawMaxSum,
+		"wm",
+		100000,
+		"Maximal sum of single withdrawal in points int64",
+	)
+	serverFlags.Int64Var(
+		&c.WithdrawDaily,
+		"wd",
+		0,
+		"Per-user withdrawals limit for last 24 hours in points int64 (0 disables limit)",
+	)
+	serverFlags.StringVar(
+		&c.ServiceToken,
+		"st",
+		"",
+		"Token for service-to-service API string (empty disables service API)",
+	)
+	serverFlags.Int64Var(
+		&c.PointsTTL,
+		"pe",
+		0,
+		"Accrued points lifetime in days int64 (0 disables expiration)",
+	)
+	serverFlags.Int64Var(
+		&c.ExpiryInterval,
+		"ei",
+		60,
+		"Points expiration check interval in minutes int64",
+	)
+	serverFlags.Int64Var(
+		&c.ExpiryNotice,
+		"en",
+		30,
+		"Show points expiring within this number of days in balance int64",
+	)
+	serverFlags.Int64Var(
+		&c.HoldTTL,
+		"ht",
+		24,
+		"Points hold TTL before automatic release in hours int64",
+	)
+	serverFlags.Int64Var(
+		&c.AccrualWorkers,
+		"aw",
+		4,
+		"Number of concurrent accrual service workers int64",
+	)
+	serverFlags.Int64Var(
+		&c.AccrualRate,
+		"ar",
+		0,
+		"Initial accrual service requests limit per minute int64 (0 means unlimited until 429)",
+	)
+	serverFlags.Int64Var(
+		&c.AccrualBackoff,
+		"ab",
+		5,
+		"Initial accrual check retry backoff per order in seconds int64",
+	)
+	serverFlags.Int64Var(
+		&c.AccrualMaxWait,
+		"am",
+		60,
+		"Maximum accrual check retry backoff per order in minutes int64",
+	)
+	serverFlags.Int64Var(
+		&c.AccrualMaxAge,
+		"ax",
+		72,
+		"Order age after which accrual checks are dead-lettered in hours int64 (0 means never)",
+	)
 	if err := serverFlags.Parse(os.Args[1:]); err != nil {
 		os.Exit(1)
 		return err
@@ -69,6 +326,51 @@ func (c *SysConfig) GetDBPath() string {
 func (c *SysConfig) GetServiceAddress() string {
 	return c.GmartAddr
 }
+func (c *SysConfig) GetServiceToken() string {
+	return c.ServiceToken
+}
+func (c *SysConfig) GetPointsTTL() time.Duration {
+	return time.Duration(c.PointsTTL) * 24 * time.Hour
+}
+func (c *SysConfig) GetExpiryNotice() time.Duration {
+	return time.Duration(c.ExpiryNotice) * 24 * time.Hour
+}
+func (c *SysConfig) GetHoldTTL() time.Duration {
+	return time.Duration(c.HoldTTL) * time.Hour
+}
+func (c *SysConfig) GetAccessTTL() time.Duration {
+	return time.Duration(c.AccessTTL) * time.Minute
+}
+func (c *SysConfig) GetRefreshTTL() time.Duration {
+	return time.Duration(c.RefreshTTL) * time.Hour
+}
+func (c *SysConfig) GetResetTTL() time.Duration {
+	return time.Duration(c.ResetTTL) * time.Minute
+}
+func (c *SysConfig) GetIdempotencyTTL() time.Duration {
+	return time.Duration(c.IdempotencyTTL) * time.Hour
+}
+func (c *SysConfig) GetWithdrawLimits() WithdrawLimits {
+	return WithdrawLimits{
+		MaxSum:     c.WithdrawMaxSum,
+		DailyLimit: c.WithdrawDaily,
+	}
+}
+func (c *SysConfig) GetLoginLimits() LoginLimits {
+	return LoginLimits{
+		MaxLoginFailures: c.LoginFailures,
+		MaxIPFailures:    c.IPFailures,
+		Backoff:          time.Duration(c.LoginBackoff) * time.Second,
+		Lockout:          time.Duration(c.LoginLockout) * time.Minute,
+	}
+}
+func (c *SysConfig) GetAccrualJobPolicy() AccrualJobPolicy {
+	return AccrualJobPolicy{
+		Backoff:    time.Duration(c.AccrualBackoff) * time.Second,
+		MaxBackoff: time.Duration(c.AccrualMaxWait) * time.Minute,
+		MaxAge:     time.Duration(c.AccrualMaxAge) * time.Hour,
+	}
+}
 func newConfig() *SysConfig {
 	return &SysConfig{}
 }
@@ -1,8 +1,21 @@
 package config
 
+import "time"
+
 type Configurator interface {
 	ParseStartupFlags() error
 	GetDBPath() string
 	GetServiceAddress() string
 	GetCBPath() string
+	GetAccessTTL() time.Duration
+	GetRefreshTTL() time.Duration
+	GetLoginLimits() LoginLimits
+	GetResetTTL() time.Duration
+	GetIdempotencyTTL() time.Duration
+	GetWithdrawLimits() WithdrawLimits
+	GetServiceToken() string
+	GetPointsTTL() time.Duration
+	GetExpiryNotice() time.Duration
+	GetHoldTTL() time.Duration
+	GetAccrualJobPolicy() AccrualJobPolicy
 }
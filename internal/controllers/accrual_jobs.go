@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/config"
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	accrualJobLease = 5 * time.Minute
+	accrualJobBatch = 100
+)
+
+func accrualBackoff(policy config.AccrualJobPolicy, attempts int64) time.Duration {
+	backoff := policy.Backoff
+	for i := int64(1); i < attempts && (policy.MaxBackoff <= 0 || backoff < policy.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+	return backoff
+}
+
+func (c *GmartController) ProcessAccrualJobs() {
+	jobs, err := c.Storage.Connector.LeaseAccrualJobs(time.Now(), accrualJobLease, accrualJobBatch)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot lease accrual jobs")
+		return
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	leased := make(map[string]storage.AccrualJob, len(jobs))
+	orders := make([]storage.Order, 0, len(jobs))
+	for _, job := range jobs {
+		leased[job.OrderID] = job
+		orders = append(orders, job.Order())
+	}
+	err = c.Cashback.CheckOrders(orders, func(val storage.Order, order storage.Order, statusCode int, err error) error {
+		return c.handleAccrualResult(leased[val.ID], order, statusCode, err)
+	})
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("error when check orders")
+	}
+}
+
+func (c *GmartController) handleAccrualResult(job storage.AccrualJob, order storage.Order, statusCode int, err error) error {
+	if err == nil {
+		switch statusCode {
+		case http.StatusOK:
+			applied, credited, err := c.Storage.Connector.ApplyAccrual(context.Background(), job.OrderID, order.Status, order.Accrual)
+			if err != nil {
+				c.Logger.Error().Err(err).Msg(fmt.Sprintf("cannot apply accrual for order %s", job.OrderID))
+				return err
+			}
+			c.Logger.Info().Msg(fmt.Sprintf("order %s updated with status %s", applied.ID, applied.Status))
+			if credited {
+				c.Logger.Info().Msg(fmt.Sprintf("credited %s points to user %s for order %s", applied.Accrual, applied.Login, applied.ID))
+			}
+			if storage.OrderFinal(applied.Status) {
+				return nil
+			}
+			err = fmt.Errorf("order %s is still %s in CB service", job.OrderID, order.Status)
+			return c.retryAccrualJob(job, err)
+		case http.StatusNoContent:
+			err = fmt.Errorf("order %s is not registered in CB service", job.OrderID)
+		default:
+			err = fmt.Errorf("CB service returned status %d for order %s", statusCode, job.OrderID)
+		}
+	}
+	return c.retryAccrualJob(job, err)
+}
+
+func (c *GmartController) retryAccrualJob(job storage.AccrualJob, reason error) error {
+	policy := c.Config.GetAccrualJobPolicy()
+	now := time.Now()
+	job.Attempts++
+	job.LastError = reason.Error()
+	job.NextAttemptAt = now.Add(accrualBackoff(policy, job.Attempts))
+	if policy.MaxAge > 0 && now.Sub(job.CreatedAt) >= policy.MaxAge {
+		job.DeadAt = &now
+	}
+	if err := c.Storage.Connector.UpdateAccrualJob(job); err != nil {
+		c.Logger.Error().Err(err).Msg(fmt.Sprintf("cannot reschedule accrual job for order %s", job.OrderID))
+		return err
+	}
+	if job.DeadAt != nil {
+		c.Logger.Error().Msg(fmt.Sprintf("accrual job for order %s dead-lettered after %d attempts: %s", job.OrderID, job.Attempts, job.LastError))
+		return nil
+	}
+	c.Logger.Warn().Msg(fmt.Sprintf("accrual job for order %s will be retried at %s: %s", job.OrderID, job.NextAttemptAt.Format(time.RFC3339), job.LastError))
+	return nil
+}
+
+func (c *GmartController) getAccrualJobs(res http.ResponseWriter, req *http.Request) {
+	var dead bool
+	switch state := req.URL.Query().Get("state"); state {
+	case "", storage.AccrualJobDead:
+		dead = true
+	case storage.AccrualJobPending:
+	default:
+		c.Logger.Error().Msg(fmt.Sprintf("wrong accrual job state %q", state))
+		http.Error(res, "state must be dead or pending", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(req, "limit", 50, 500)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong limit parameter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(req, "offset", 0, 0)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong offset parameter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jobs, err := c.Storage.Connector.GetAccrualJobs(dead, limit, offset)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get accrual jobs")
+		http.Error(res, "cannot get accrual jobs", http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []storage.AccrualJob{}
+	}
+	c.writeJSON(res, http.StatusOK, jobs)
+}
+
+func (c *GmartController) requeueAccrualJob(res http.ResponseWriter, req *http.Request) {
+	admin, _ := middlewares.UserFromContext(req.Context())
+	orderID := chi.URLParam(req, "order")
+	job, err := c.Storage.Connector.RequeueAccrualJob(orderID, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrAccrualJobNotFound) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("accrual job for order %s not found", orderID))
+			http.Error(res, "accrual job not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot requeue accrual job")
+		http.Error(res, "cannot requeue accrual job", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%s requeued accrual job for order %s of user %s", admin.Login, job.OrderID, job.Login))
+	c.writeJSON(res, http.StatusOK, job)
+}
+
+func (c *GmartController) ReconcileAccruals() {
+	mismatches, err := c.Storage.Connector.GetAccrualMismatches()
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot reconcile accruals")
+		return
+	}
+	for _, mismatch := range mismatches {
+		c.Logger.Error().Msg(fmt.Sprintf(
+			"order %s of user %s has status %s and accrual %s but ledger credited %s",
+			mismatch.OrderID,
+			mismatch.Login,
+			mismatch.Status,
+			mismatch.Accrual,
+			mismatch.Credited,
+		))
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d accrual mismatches found", len(mismatches)))
+}
+
+func (c *GmartController) getAccrualMismatches(res http.ResponseWriter, req *http.Request) {
+	mismatches, err := c.Storage.Connector.GetAccrualMismatches()
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot reconcile accruals")
+		http.Error(res, "cannot reconcile accruals", http.StatusInternalServerError)
+		return
+	}
+	if mismatches == nil {
+		mismatches = []storage.AccrualMismatch{}
+	}
+	c.writeJSON(res, http.StatusOK, mismatches)
+}
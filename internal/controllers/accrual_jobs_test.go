@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/config"
+)
+
+func TestAccrualBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   config.AccrualJobPolicy
+		attempts int64
+		want     time.Duration
+	}{
+		{"first retry", config.AccrualJobPolicy{Backoff: 5 * time.Second, MaxBackoff: time.Hour}, 1, 5 * time.Second},
+		{"doubles", config.AccrualJobPolicy{Backoff: 5 * time.Second, MaxBackoff: time.Hour}, 4, 40 * time.Second},
+		{"capped", config.AccrualJobPolicy{Backoff: 5 * time.Second, MaxBackoff: time.Minute}, 5, time.Minute},
+		{"capped after many attempts", config.AccrualJobPolicy{Backoff: 5 * time.Second, MaxBackoff: time.Minute}, 500, time.Minute},
+		{"uncapped", config.AccrualJobPolicy{Backoff: time.Second}, 11, 1024 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accrualBackoff(tt.policy, tt.attempts); got != tt.want {
+				t.Errorf("accrualBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+func (c *GmartController) setUserRole(res http.ResponseWriter, req *http.Request) {
+	admin, _ := middlewares.UserFromContext(req.Context())
+	login := chi.URLParam(req, "login")
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	user := storage.User{}
+	err = json.Unmarshal(body, &user)
+	if err != nil || !user.Role.Valid() {
+		c.Logger.Error().Err(err).Msg("wrong role in body")
+		http.Error(res, "wrong role in body", http.StatusBadRequest)
+		return
+	}
+	rows, err := c.Storage.Connector.SetUserRole(login, user.Role)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot set user role")
+		http.Error(res, "cannot set user role", http.StatusInternalServerError)
+		return
+	}
+	if rows == 0 {
+		c.Logger.Error().Msg("user not found")
+		http.Error(res, "user not found", http.StatusNotFound)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("admin %s set role %s to user %s", admin.Login, user.Role, login))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) searchUsers(res http.ResponseWriter, req *http.Request) {
+	limit, err := queryInt(req, "limit", 50, 500)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong limit parameter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(req, "offset", 0, 0)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong offset parameter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	users, err := c.Storage.Connector.SearchUsers(req.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot search users")
+		http.Error(res, "cannot search users", http.StatusInternalServerError)
+		return
+	}
+	c.writeJSON(res, http.StatusOK, users)
+}
+
+func (c *GmartController) getUserDetails(res http.ResponseWriter, req *http.Request) {
+	login := chi.URLParam(req, "login")
+	user, err := c.Storage.Connector.GetUser(login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.Logger.Error().Err(err).Msg("user not found")
+			http.Error(res, "user not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot get user")
+		http.Error(res, "cannot get user", http.StatusInternalServerError)
+		return
+	}
+	details := storage.UserDetails{User: user}
+	details.Balance.Current, details.Balance.Withdrawn, err = c.Storage.Connector.CheckUserBalance(login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user balance")
+		http.Error(res, "cannot get user balance", http.StatusInternalServerError)
+		return
+	}
+	details.Orders, err = c.Storage.Connector.GetUserOrders(login, storage.OrderFilter{Desc: true, Limit: 100})
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user orders")
+		http.Error(res, "cannot get user orders", http.StatusInternalServerError)
+		return
+	}
+	details.Withdrawals, err = c.Storage.Connector.GetUserWithdrawals(login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user withdrawals")
+		http.Error(res, "cannot get user withdrawals", http.StatusInternalServerError)
+		return
+	}
+	details.Adjustments, err = c.Storage.Connector.GetUserAdjustments(login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user adjustments")
+		http.Error(res, "cannot get user adjustments", http.StatusInternalServerError)
+		return
+	}
+	c.writeJSON(res, http.StatusOK, details)
+}
+
+func (c *GmartController) blockUser(res http.ResponseWriter, req *http.Request) {
+	c.setUserBlocked(res, req, true)
+}
+
+func (c *GmartController) unblockUser(res http.ResponseWriter, req *http.Request) {
+	c.setUserBlocked(res, req, false)
+}
+
+func (c *GmartController) canManageUser(res http.ResponseWriter, admin middlewares.Principal, login string) bool {
+	if admin.Role == storage.RoleAdmin {
+		return true
+	}
+	user, err := c.Storage.Connector.GetUser(login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.Logger.Error().Err(err).Msg("user not found")
+			http.Error(res, "user not found", http.StatusNotFound)
+			return false
+		}
+		c.Logger.Error().Err(err).Msg("cannot get user")
+		http.Error(res, "cannot get user", http.StatusInternalServerError)
+		return false
+	}
+	if user.Role == storage.RoleAdmin || user.Role == storage.RoleSupport {
+		c.Logger.Error().Msg(fmt.Sprintf("%s %s tried to manage %s %s", admin.Role, admin.Login, user.Role, login))
+		http.Error(res, "Access denied", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (c *GmartController) setUserBlocked(res http.ResponseWriter, req *http.Request, blocked bool) {
+	admin, _ := middlewares.UserFromContext(req.Context())
+	login := chi.URLParam(req, "login")
+	if !c.canManageUser(res, admin, login) {
+		return
+	}
+	rows, err := c.Storage.Connector.SetUserBlocked(login, blocked)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot update user blocked state")
+		http.Error(res, "cannot update user blocked state", http.StatusInternalServerError)
+		return
+	}
+	if rows == 0 {
+		c.Logger.Error().Msg("user not found")
+		http.Error(res, "user not found", http.StatusNotFound)
+		return
+	}
+	if blocked {
+		if _, err = c.Storage.Sessions.RevokeUserSessions(login, ""); err != nil {
+			c.Logger.Error().Err(err).Msg("user blocked, but can't revoke sessions")
+			http.Error(res, "user blocked, but can't revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%s %s set blocked=%t to user %s", admin.Role, admin.Login, blocked, login))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) logoutUserByAdmin(res http.ResponseWriter, req *http.Request) {
+	admin, _ := middlewares.UserFromContext(req.Context())
+	login := chi.URLParam(req, "login")
+	if !c.canManageUser(res, admin, login) {
+		return
+	}
+	revoked, err := c.Storage.Sessions.RevokeUserSessions(login, "")
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot revoke user sessions")
+		http.Error(res, "cannot revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%s %s revoked %d sessions of user %s", admin.Role, admin.Login, revoked, login))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) postAdjustment(res http.ResponseWriter, req *http.Request) {
+	admin, _ := middlewares.UserFromContext(req.Context())
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	adjustment := storage.Adjustment{}
+	err = json.Unmarshal(body, &adjustment)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
+		http.Error(res, "cannot unmarshal request body", http.StatusBadRequest)
+		return
+	}
+	if adjustment.Sum == 0 {
+		c.Logger.Error().Msg("adjustment sum is zero")
+		http.Error(res, "adjustment sum must not be zero", http.StatusUnprocessableEntity)
+		return
+	}
+	if _, ok := storage.AdjustmentReasons[adjustment.Reason]; !ok {
+		c.Logger.Error().Msg(fmt.Sprintf("unknown adjustment reason %q", adjustment.Reason))
+		http.Error(res, "unknown adjustment reason", http.StatusUnprocessableEntity)
+		return
+	}
+	adjustment.Note = strings.TrimSpace(adjustment.Note)
+	if adjustment.Note == "" {
+		c.Logger.Error().Msg("adjustment note is empty")
+		http.Error(res, "adjustment note is required", http.StatusUnprocessableEntity)
+		return
+	}
+	adjustment.Login = chi.URLParam(req, "login")
+	if _, err = c.Storage.Connector.GetUser(adjustment.Login); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.Logger.Error().Err(err).Msg("user not found")
+			http.Error(res, "user not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot get user")
+		http.Error(res, "cannot get user", http.StatusInternalServerError)
+		return
+	}
+	adjustment.Actor = admin.Login
+	adjustment.ProcessedAt = time.Now().Format(time.RFC3339)
+	_, err = c.Storage.Connector.RegisterBalanceAdjustment(adjustment)
+	if err != nil {
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("adjustment of %s would make balance of user %s negative", adjustment.Sum, adjustment.Login))
+			http.Error(res, "adjustment would make balance negative", http.StatusConflict)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot register adjustment")
+		http.Error(res, "cannot register adjustment", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf(
+		"admin %s adjusted balance of user %s by %s with reason %s",
+		admin.Login,
+		adjustment.Login,
+		adjustment.Sum,
+		adjustment.Reason,
+	))
+	c.writeJSON(res, http.StatusCreated, adjustment)
+}
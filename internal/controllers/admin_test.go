@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/config"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/rs/zerolog"
+)
+
+type adminTestConfig struct {
+	config.Configurator
+}
+
+func (adminTestConfig) GetServiceToken() string {
+	return "service"
+}
+
+type adminTestConnector struct {
+	storage.Connector
+	users map[string]storage.User
+}
+
+func (a *adminTestConnector) GetUser(login string) (storage.User, error) {
+	user, ok := a.users[login]
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (a *adminTestConnector) SetUserRole(login string, role storage.Role) (int64, error) {
+	if _, ok := a.users[login]; !ok {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (a *adminTestConnector) SetUserBlocked(login string, blocked bool) (int64, error) {
+	if _, ok := a.users[login]; !ok {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (a *adminTestConnector) GetAccrualJobs(dead bool, limit int64, offset int64) ([]storage.AccrualJob, error) {
+	return nil, nil
+}
+
+func newAdminTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	log := zerolog.Nop()
+	sessions := storage.NewMemSessionStore()
+	users := map[string]storage.User{}
+	for _, user := range []storage.User{
+		{Login: "gopher", Role: storage.RoleUser},
+		{Login: "helper", Role: storage.RoleSupport},
+		{Login: "root", Role: storage.RoleAdmin},
+	} {
+		users[user.Login] = user
+		err := sessions.IssueSession(storage.Token{ID: user.Login, User: user.Login, Token: user.Login + "-token", Created: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &GmartController{
+		Logger: &log,
+		Config: adminTestConfig{},
+		Storage: &storage.Storage{
+			Logger:    &log,
+			Sessions:  sessions,
+			Connector: &adminTestConnector{users: users},
+		},
+	}
+	return c.Route()
+}
+
+type adminRouteCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	want   map[string]int
+}
+
+func runAdminRouteCases(t *testing.T, tests []adminRouteCase) {
+	t.Helper()
+	for _, tt := range tests {
+		for login, want := range tt.want {
+			t.Run(tt.name+"/"+login, func(t *testing.T) {
+				router := newAdminTestRouter(t)
+				req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				req.Header.Set("Authorization", login+"-token")
+				res := httptest.NewRecorder()
+				router.ServeHTTP(res, req)
+				if res.Code != want {
+					t.Errorf("%s %s as %s = %d, want %d", tt.method, tt.path, login, res.Code, want)
+				}
+			})
+		}
+	}
+}
+
+func TestAdminRoutesRoleGating(t *testing.T) {
+	runAdminRouteCases(t, []adminRouteCase{
+		{
+			name:   "admin only route",
+			method: http.MethodPut,
+			path:   "/api/admin/users/gopher/role",
+			body:   `{"role":"support"}`,
+			want:   map[string]int{"gopher": http.StatusForbidden, "helper": http.StatusForbidden, "root": http.StatusOK},
+		},
+		{
+			name:   "support route",
+			method: http.MethodGet,
+			path:   "/api/admin/accrual/jobs",
+			want:   map[string]int{"gopher": http.StatusForbidden, "helper": http.StatusOK, "root": http.StatusOK},
+		},
+	})
+}
+
+func TestAdminUserManagementTargets(t *testing.T) {
+	runAdminRouteCases(t, []adminRouteCase{
+		{
+			name:   "block user",
+			method: http.MethodPost,
+			path:   "/api/admin/users/gopher/block",
+			want:   map[string]int{"gopher": http.StatusForbidden, "helper": http.StatusOK, "root": http.StatusOK},
+		},
+		{
+			name:   "unblock admin",
+			method: http.MethodPost,
+			path:   "/api/admin/users/root/unblock",
+			want:   map[string]int{"gopher": http.StatusForbidden, "helper": http.StatusForbidden, "root": http.StatusOK},
+		},
+		{
+			name:   "logout support",
+			method: http.MethodPost,
+			path:   "/api/admin/users/helper/logout",
+			want:   map[string]int{"gopher": http.StatusForbidden, "helper": http.StatusForbidden, "root": http.StatusOK},
+		},
+	})
+}
+
+func TestAdminRoutesRequireCredentials(t *testing.T) {
+	router := newAdminTestRouter(t)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/admin/accrual/jobs", nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusUnauthorized)
+	}
+}
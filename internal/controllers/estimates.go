@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type estimateRequest struct {
+	Accrual json.RawMessage `json:"accrual"`
+}
+
+func (c *GmartController) setOrderEstimate(res http.ResponseWriter, req *http.Request) {
+	orderID := chi.URLParam(req, "order")
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	estimateReq := estimateRequest{}
+	if err = json.Unmarshal(body, &estimateReq); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
+		http.Error(res, "cannot unmarshal request body", http.StatusBadRequest)
+		return
+	}
+	estimate, err := storage.ParseMoney(strings.Trim(string(estimateReq.Accrual), `"`))
+	if err != nil || estimate < 0 {
+		c.Logger.Error().Err(err).Msg(fmt.Sprintf("wrong accrual estimate for order %s", orderID))
+		http.Error(res, "accrual must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+	order, err := c.Storage.Connector.GetOrder(orderID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderNotFound) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("order %s not found", orderID))
+			http.Error(res, "order not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("error when searching for order in DB")
+		http.Error(res, "error when searching for order in DB", http.StatusInternalServerError)
+		return
+	}
+	rows, err := c.Storage.Connector.SetOrderEstimate(orderID, estimate)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot set order estimate")
+		http.Error(res, "cannot set order estimate", http.StatusInternalServerError)
+		return
+	}
+	if rows == 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("order %s is already %s", orderID, order.Status))
+		http.Error(res, "order is already processed", http.StatusConflict)
+		return
+	}
+	order.Estimate = estimate
+	c.Logger.Info().Msg(fmt.Sprintf("order %s of user %s estimated at %s", order.ID, order.Login, estimate))
+	c.writeJSON(res, http.StatusOK, order)
+}
@@ -1,19 +1,21 @@
 package controllers
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/HellfastUSMC/gophermart/internal/auth_tokens"
 	"github.com/HellfastUSMC/gophermart/internal/cashback_connector"
 	"github.com/HellfastUSMC/gophermart/internal/config"
+	"github.com/HellfastUSMC/gophermart/internal/cred_policy"
 	"github.com/HellfastUSMC/gophermart/internal/logger"
 	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/notifier"
 	"github.com/HellfastUSMC/gophermart/internal/storage"
 	"github.com/ShiraazMoollatjie/goluhn"
 	"github.com/go-chi/chi/v5"
@@ -25,23 +27,70 @@ type GmartController struct {
 	Storage  *storage.Storage
 	Cashback cbconnector.Cashback
 	Status   *storage.CurrentStats
+	Signer   authtokens.Signer
+	Notifier notifier.Notifier
+	Policy   *credpolicy.Policy
 }
 
 func (c *GmartController) Route() *chi.Mux {
 	router := chi.NewRouter()
-	router.Use(middlewares.CheckAuth(c.Logger, c.Storage.Tokens))
 	router.Use(middlewares.RequestPrinter(c.Logger))
+	checkAuth := middlewares.CheckAuth(c.Logger, c.Storage.Sessions, c.Signer, c.Storage.Connector)
+	idempotency := middlewares.Idempotency(c.Logger, c.Storage.Connector)
 	router.Route("/api/status", func(router chi.Router) {
+		router.Use(checkAuth)
 		router.Get("/", c.getStatus)
 	})
 	router.Route("/api/user", func(router chi.Router) {
-		router.Get("/orders", c.getUserOrders)
-		router.Get("/balance", c.getUserBalance)
-		router.Get("/withdrawals", c.getUserWithdrawals)
-		router.Post("/register", c.registerUser)
-		router.Post("/login", c.loginUser)
-		router.Post("/orders", c.postOrder)
-		router.Post("/balance/withdraw", c.withdrawFromBalance)
+		router.Group(func(router chi.Router) {
+			router.Post("/register", c.registerUser)
+			router.Post("/login", c.loginUser)
+			router.Post("/token/refresh", c.refreshToken)
+			router.Post("/password/reset", c.requestPasswordReset)
+			router.Post("/password/reset/confirm", c.confirmPasswordReset)
+		})
+		router.Group(func(router chi.Router) {
+			router.Use(checkAuth)
+			router.Get("/orders", c.getUserOrders)
+			router.Get("/balance", c.getUserBalance)
+			router.Get("/withdrawals", c.getUserWithdrawals)
+			router.Get("/adjustments", c.getUserAdjustments)
+			router.Get("/history", c.getUserHistory)
+			router.Get("/statement", c.getUserStatement)
+			router.Get("/sessions", c.getUserSessions)
+			router.With(idempotency).Post("/orders", c.postOrder)
+			router.With(idempotency).Post("/balance/withdraw", c.withdrawFromBalance)
+			router.Post("/password", c.changePassword)
+			router.Post("/logout", c.logoutUser)
+			router.Post("/logout/all", c.logoutUserEverywhere)
+			router.Delete("/sessions/{id}", c.revokeUserSession)
+		})
+	})
+	router.Route("/api/admin", func(router chi.Router) {
+		router.Use(checkAuth)
+		router.Use(middlewares.RequireRole(c.Logger, storage.RoleSupport, storage.RoleAdmin))
+		router.Get("/users", c.searchUsers)
+		router.Get("/users/{login}", c.getUserDetails)
+		router.Post("/users/{login}/block", c.blockUser)
+		router.Post("/users/{login}/unblock", c.unblockUser)
+		router.Post("/users/{login}/logout", c.logoutUserByAdmin)
+		router.Get("/accrual/jobs", c.getAccrualJobs)
+		router.Get("/accrual/reconciliation", c.getAccrualMismatches)
+		router.Group(func(router chi.Router) {
+			router.Use(middlewares.RequireRole(c.Logger, storage.RoleAdmin))
+			router.Put("/users/{login}/role", c.setUserRole)
+			router.Post("/users/{login}/adjustments", c.postAdjustment)
+			router.Post("/withdrawals/{order}/reversal", c.reverseWithdrawal)
+			router.Post("/accrual/jobs/{order}/requeue", c.requeueAccrualJob)
+		})
+	})
+	router.Route("/api/service", func(router chi.Router) {
+		router.Use(middlewares.CheckServiceToken(c.Logger, c.Config.GetServiceToken()))
+		router.Post("/withdrawals/{order}/reversal", c.reverseWithdrawal)
+		router.With(idempotency).Post("/holds", c.createHold)
+		router.Post("/holds/{id}/capture", c.captureHold)
+		router.Post("/holds/{id}/release", c.releaseHold)
+		router.Put("/orders/{order}/estimate", c.setOrderEstimate)
 	})
 	return router
 }
@@ -65,129 +114,150 @@ func (c *GmartController) getStatus(res http.ResponseWriter, req *http.Request)
 
 func (c *GmartController) withdrawFromBalance(res http.ResponseWriter, req *http.Request) {
 	body, err := io.ReadAll(req.Body)
-	token := req.Header.Get("Authorization")
+	user, _ := middlewares.UserFromContext(req.Context())
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot read request body")
 		http.Error(res, "cannot read request body", http.StatusInternalServerError)
 		return
 	}
-	withdraw := storage.Bonus{}
+	withdraw := withdrawRequest{}
 	err = json.Unmarshal(body, &withdraw)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
-		http.Error(res, "cannot unmarshal request body", http.StatusInternalServerError)
+		c.writeFieldErrors(res, http.StatusBadRequest, []fieldError{
+			{Field: "body", Rule: "format", Message: "request body must be a JSON object with order and sum"},
+		})
 		return
 	}
-	withdraw.ProcessedAt = time.Now().Format(time.RFC3339)
-	for key, val := range c.Storage.Tokens {
-		if val.Token == token {
-			withdraw.Login = key
-			break
-		}
+	sum, violations, status := c.validateWithdrawal(withdraw)
+	if len(violations) > 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("withdrawal of user %s violates %d rules", user.Login, len(violations)))
+		c.writeFieldErrors(res, status, violations)
+		return
 	}
-	_, err = c.Storage.Connector.RegisterBonusChange(withdraw.OrderID, withdraw.Sum, withdraw.ProcessedAt, withdraw.Login, true)
+	_, dailyLimit := c.withdrawLimits()
+	err = c.Storage.Connector.Withdraw(req.Context(), user.Login, withdraw.Order, sum, dailyLimit)
 	if err != nil {
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("user %s has not enough points to withdraw %s", user.Login, sum))
+			c.writeFieldErrors(res, http.StatusPaymentRequired, []fieldError{
+				{Field: "sum", Rule: "insufficient_funds", Message: "not enough points on balance"},
+			})
+			return
+		}
+		if errors.Is(err, storage.ErrDailyLimitExceeded) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("user %s exceeded daily withdrawal limit with %s", user.Login, sum))
+			c.writeFieldErrors(res, http.StatusPaymentRequired, []fieldError{
+				{Field: "sum", Rule: "daily_limit", Message: fmt.Sprintf("withdrawals for last 24 hours must not exceed %s", dailyLimit)},
+			})
+			return
+		}
+		if errors.Is(err, storage.ErrOrderAlreadyWithdrawn) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("order %s already used for withdrawal", withdraw.Order))
+			c.writeFieldErrors(res, http.StatusConflict, []fieldError{
+				{Field: "order", Rule: "unique", Message: "order number already used for withdrawal"},
+			})
+			return
+		}
 		c.Logger.Error().Err(err).Msg("cannot register withdraw")
 		http.Error(res, "cannot register withdraw", http.StatusInternalServerError)
 		return
 	}
-	_, err = c.Storage.Connector.UpdateUserBalance(c.Storage.CheckUserBalance, withdraw.Login, withdraw.Sum, true)
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) CheckTokens() {
+	idleTTL := 1 * time.Hour
+	if c.Signer != nil {
+		idleTTL = c.Config.GetRefreshTTL()
+	}
+	expired, err := c.Storage.Sessions.ExpireSessions(time.Now().Add(-idleTTL))
 	if err != nil {
-		c.Logger.Error().Err(err).Msg("cannot sub user balance")
-		http.Error(res, "cannot sub user balance", http.StatusInternalServerError)
+		c.Logger.Error().Err(err).Msg("cannot expire sessions")
 		return
 	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d sessions expired", expired))
+	expired, err = c.Storage.Sessions.ExpireRefreshTokens(time.Now())
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot expire refresh tokens")
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d refresh tokens expired", expired))
 }
 
-func (c *GmartController) CheckTokens() {
-	for key, val := range c.Storage.Tokens {
-		if time.Since(val.Created) > 1*time.Hour {
-			delete(c.Storage.Tokens, key)
-		}
+func (c *GmartController) CheckIdempotencyKeys() {
+	expired, err := c.Storage.Connector.ExpireIdempotencyKeys(time.Now().Add(-c.Config.GetIdempotencyTTL()))
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot expire idempotency keys")
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d idempotency keys expired", expired))
+}
+
+func (c *GmartController) ExpirePoints() {
+	expired, err := c.Storage.Connector.ExpireLots(time.Now())
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot expire points")
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d points lots expired", expired))
+}
+
+func (c *GmartController) ReleaseExpiredHolds() {
+	released, err := c.Storage.Connector.ReleaseExpiredHolds(time.Now())
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot release expired holds")
+		return
 	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d expired holds released", released))
 }
 
 func (c *GmartController) postOrder(res http.ResponseWriter, req *http.Request) {
 	body, err := io.ReadAll(req.Body)
-	token := req.Header.Get("Authorization")
+	user, _ := middlewares.UserFromContext(req.Context())
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot read request body")
 		http.Error(res, "cannot read request body", http.StatusInternalServerError)
 		return
 	}
-	login := ""
-	for key, val := range c.Storage.Tokens {
-		if val.Token == token {
-			login = key
-			break
-		}
+	login := user.Login
+	orderID := strings.TrimSpace(string(body))
+	if orderID == "" {
+		c.Logger.Error().Msg("empty order number")
+		http.Error(res, "order number is required", http.StatusBadRequest)
+		return
 	}
-	orderID := string(body)
 	err = goluhn.Validate(orderID)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("wrong order number")
 		http.Error(res, "wrong order number", http.StatusUnprocessableEntity)
 		return
 	}
-	_, err = c.Storage.Connector.RegisterOrder(orderID, 0, time.Now().Format(time.RFC3339), login)
+	placedAt := time.Now().Format(time.RFC3339)
+	_, err = c.Storage.Connector.RegisterOrder(orderID, 0, placedAt, login)
 	if err != nil {
-		if strings.Contains(err.Error(), "23505") {
-			order, err := c.Storage.Connector.GetOrder(orderID)
-			if err != nil {
-				c.Logger.Error().Err(err).Msg("error when searching for order in DB")
-				http.Error(res, "error when searching for order in DB", http.StatusInternalServerError)
-				return
-			}
-			if order.Login == login {
-				orderJSON, err := json.Marshal(order)
-				if err != nil {
-					c.Logger.Error().Err(err).Msg("error when marshaling order")
-					http.Error(res, "error when marshaling order", http.StatusInternalServerError)
-					return
-				}
-				res.Header().Add("Content-Type", "application/json")
-				res.Header().Add("Date", time.Now().Format(http.TimeFormat))
-				res.WriteHeader(http.StatusOK)
-				_, err = res.Write(orderJSON)
-				if err != nil {
-					c.Logger.Error().Err(err).Msg("cannot write response")
-					http.Error(res, "cannot write response", http.StatusInternalServerError)
-					return
-				}
-			}
+		if !strings.Contains(err.Error(), "23505") {
+			c.Logger.Error().Err(err).Msg("cannot register order")
+			http.Error(res, "cannot register order", http.StatusInternalServerError)
+			return
 		}
-		c.Logger.Error().Err(err).Msg("order already exist")
-		http.Error(res, "order already exist", http.StatusConflict)
-		return
-	}
-	order, _, err := c.Cashback.CheckOrder(orderID)
-	if err != nil {
-		c.Logger.Error().Msg("error in checking order in CB")
-		http.Error(res, "error in checking order in CB", http.StatusInternalServerError)
-		return
-	}
-	if order.Status == "PROCESSED" {
-		_, err = c.Storage.Connector.UpdateOrder(order.ID, order.Accrual, order.Status)
+		order, err := c.Storage.Connector.GetOrder(orderID)
 		if err != nil {
-			c.Logger.Error().Msg("error in update order in DB")
-			http.Error(res, "error in update order in DB", http.StatusInternalServerError)
+			c.Logger.Error().Err(err).Msg("error when searching for order in DB")
+			http.Error(res, "error when searching for order in DB", http.StatusInternalServerError)
 			return
 		}
-		_, err = c.Storage.Connector.UpdateUserBalance(c.Storage.CheckUserBalance, login, order.Accrual, false)
-		if err != nil {
-			c.Logger.Error().Msg("error in update user balance in DB")
-			http.Error(res, "error in update user balance in DB", http.StatusInternalServerError)
+		if order.Login != login {
+			c.Logger.Error().Msg(fmt.Sprintf("user %s tried to upload order %s of another user", login, orderID))
+			http.Error(res, "order already uploaded by another user", http.StatusConflict)
 			return
 		}
-	}
-	if order.Status == "INVALID" {
-		c.Logger.Error().Msg("order rejected from CB")
-		http.Error(res, "order rejected from CB", http.StatusConflict)
+		c.writeJSON(res, http.StatusOK, order)
 		return
 	}
-	res.Header().Add("Content-Type", "application/json")
-	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
-	res.WriteHeader(http.StatusAccepted)
+	c.Logger.Info().Msg(fmt.Sprintf("order %s of user %s accepted for processing", orderID, login))
+	c.writeJSON(res, http.StatusAccepted, storage.Order{ID: orderID, Status: "NEW", Date: placedAt})
 }
 
 func (c *GmartController) loginUser(res http.ResponseWriter, req *http.Request) {
@@ -209,6 +279,19 @@ func (c *GmartController) loginUser(res http.ResponseWriter, req *http.Request)
 		http.Error(res, "login or password missing in body", http.StatusInternalServerError)
 		return
 	}
+	now, ip := time.Now(), clientIP(req)
+	status, retryAfter, err := c.checkLoginAllowed(userCreds.Login, ip, now)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot check login attempts")
+		http.Error(res, "cannot check login attempts", http.StatusInternalServerError)
+		return
+	}
+	if status != 0 {
+		c.Logger.Warn().Msg(fmt.Sprintf("login attempt for %s from %s rejected, retry after %s", userCreds.Login, ip, retryAfter))
+		setRetryAfter(res, retryAfter)
+		http.Error(res, "too many failed login attempts", status)
+		return
+	}
 	auth, err := c.Storage.Connector.CheckUserCreds(userCreds.Login, userCreds.Password)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot check provided credentials")
@@ -216,16 +299,47 @@ func (c *GmartController) loginUser(res http.ResponseWriter, req *http.Request)
 		return
 	}
 	if !auth {
-		c.Logger.Error().Err(err).Msg("provided credentials are incorrect")
-		http.Error(res, "provided credentials are incorrect", http.StatusInternalServerError)
+		if err = c.registerLoginFailure(userCreds.Login, ip, now); err != nil {
+			c.Logger.Error().Err(err).Msg("cannot register failed login attempt")
+		}
+		c.Logger.Error().Msg("provided credentials are incorrect")
+		http.Error(res, "provided credentials are incorrect", http.StatusUnauthorized)
+		return
+	}
+	if err = c.Storage.Connector.ResetLoginAttempts(loginSubject(userCreds.Login)); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot reset login attempts")
+	}
+	user, err := c.Storage.Connector.GetUser(userCreds.Login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user")
+		http.Error(res, "cannot get user", http.StatusInternalServerError)
+		return
+	}
+	if user.Blocked {
+		c.Logger.Error().Msg(fmt.Sprintf("blocked user %s tried to login", user.Login))
+		http.Error(res, "account is blocked", http.StatusForbidden)
+		return
+	}
+	var (
+		resp        any
+		accessToken string
+	)
+	session, err := c.issueSession(userCreds.Login, req)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot issue session")
+		http.Error(res, "cannot issue session", http.StatusInternalServerError)
 		return
 	}
-	resp := storage.Token{
-		Created: time.Now(),
-		User:    userCreds.Login,
-		Token:   c.generateToken(),
+	resp, accessToken = map[string]string{"Token": session.Token}, session.Token
+	if c.Signer != nil {
+		pair, err := c.issueTokenPair(userCreds.Login, session.ID)
+		if err != nil {
+			c.Logger.Error().Err(err).Msg("cannot issue tokens")
+			http.Error(res, "cannot issue tokens", http.StatusInternalServerError)
+			return
+		}
+		resp, accessToken = pair, pair.Token
 	}
-	c.Storage.Tokens[userCreds.Login] = resp
 	respJSON, err := json.Marshal(resp)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot marshal response")
@@ -233,7 +347,7 @@ func (c *GmartController) loginUser(res http.ResponseWriter, req *http.Request)
 		return
 	}
 	res.Header().Add("Content-Type", "application/json")
-	res.Header().Add("Authorization", resp.Token)
+	res.Header().Add("Authorization", accessToken)
 	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
 	res.WriteHeader(http.StatusOK)
 	if _, err = res.Write(respJSON); err != nil {
@@ -261,9 +375,9 @@ func (c *GmartController) registerUser(res http.ResponseWriter, req *http.Reques
 		http.Error(res, "cannot unmarshal request body", http.StatusInternalServerError)
 		return
 	}
-	if userCreds.Login == "" || userCreds.Password == "" {
-		c.Logger.Error().Msg("login or password missing in body")
-		http.Error(res, "login or password missing in body", http.StatusInternalServerError)
+	if violations := c.Policy.Check(userCreds.Login, userCreds.Password); len(violations) > 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("credentials of user %s violate %d policy rules", userCreds.Login, len(violations)))
+		c.writeFieldErrors(res, http.StatusBadRequest, policyErrors(violations))
 		return
 	}
 	_, err = c.Storage.Connector.RegisterUser(userCreds.Login, userCreds.Password)
@@ -272,13 +386,27 @@ func (c *GmartController) registerUser(res http.ResponseWriter, req *http.Reques
 		http.Error(res, "cannot add user to DB", http.StatusInternalServerError)
 		return
 	}
-	token := storage.Token{
-		Created: time.Now(),
-		User:    userCreds.Login,
-		Token:   c.generateToken(),
+	var (
+		resp        any
+		accessToken string
+	)
+	session, err := c.issueSession(userCreds.Login, req)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("user registered, but can't issue session")
+		http.Error(res, "user registered, but can't issue session", http.StatusInternalServerError)
+		return
+	}
+	resp, accessToken = map[string]string{"Token": session.Token}, session.Token
+	if c.Signer != nil {
+		pair, err := c.issueTokenPair(userCreds.Login, session.ID)
+		if err != nil {
+			c.Logger.Error().Err(err).Msg("user registered, but can't issue tokens")
+			http.Error(res, "user registered, but can't issue tokens", http.StatusInternalServerError)
+			return
+		}
+		resp, accessToken = pair, pair.Token
 	}
-	c.Storage.Tokens[userCreds.Login] = token
-	tokenJSON, err := json.Marshal(map[string]string{"Token": token.Token})
+	tokenJSON, err := json.Marshal(resp)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("user registered, but can't marshal token")
 		http.Error(res, "user registered, but can't marshal token", http.StatusInternalServerError)
@@ -286,7 +414,7 @@ func (c *GmartController) registerUser(res http.ResponseWriter, req *http.Reques
 	}
 	res.Header().Add("Content-Type", "application/json")
 	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
-	res.Header().Add("Authorization", token.Token)
+	res.Header().Add("Authorization", accessToken)
 	res.WriteHeader(http.StatusOK)
 	_, err = res.Write(tokenJSON)
 	if err != nil {
@@ -296,17 +424,155 @@ func (c *GmartController) registerUser(res http.ResponseWriter, req *http.Reques
 	}
 }
 
-func (c *GmartController) generateToken() (token string) {
-	data := make([]byte, 16)
-	for i := range data {
-		data[i] = byte(rand.Intn(256))
+func (c *GmartController) issueSession(login string, req *http.Request) (storage.Token, error) {
+	id, err := authtokens.GenerateToken()
+	if err != nil {
+		return storage.Token{}, err
+	}
+	now := time.Now()
+	session := storage.Token{
+		ID:        id,
+		Created:   now,
+		LastSeen:  now,
+		User:      login,
+		UserAgent: req.UserAgent(),
+		IP:        clientIP(req),
+	}
+	if c.Signer == nil {
+		session.Token, err = authtokens.GenerateToken()
+		if err != nil {
+			return storage.Token{}, err
+		}
+	}
+	if err = c.Storage.Sessions.IssueSession(session); err != nil {
+		return storage.Token{}, err
+	}
+	return session, nil
+}
+
+func (c *GmartController) issueTokenPair(login string, sessionID string) (storage.TokenPair, error) {
+	now := time.Now()
+	jti, err := authtokens.GenerateToken()
+	if err != nil {
+		return storage.TokenPair{}, err
+	}
+	expiresAt := now.Add(c.Config.GetAccessTTL())
+	accessToken, err := c.Signer.Sign(authtokens.Claims{
+		Subject:   login,
+		ID:        jti,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return storage.TokenPair{}, err
+	}
+	refreshToken, err := authtokens.GenerateToken()
+	if err != nil {
+		return storage.TokenPair{}, err
+	}
+	err = c.Storage.Sessions.IssueRefreshToken(storage.RefreshToken{
+		Token:     refreshToken,
+		Family:    sessionID,
+		User:      login,
+		Created:   now,
+		ExpiresAt: now.Add(c.Config.GetRefreshTTL()),
+	})
+	if err != nil {
+		return storage.TokenPair{}, err
+	}
+	return storage.TokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (c *GmartController) refreshToken(res http.ResponseWriter, req *http.Request) {
+	if c.Signer == nil {
+		c.Logger.Error().Msg("refresh tokens are disabled")
+		http.Error(res, "refresh tokens are disabled", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	refreshReq := storage.TokenPair{}
+	err = json.Unmarshal(body, &refreshReq)
+	if err != nil || refreshReq.RefreshToken == "" {
+		c.Logger.Error().Err(err).Msg("refresh token missing in body")
+		http.Error(res, "refresh token missing in body", http.StatusBadRequest)
+		return
+	}
+	refresh, err := c.Storage.Sessions.UseRefreshToken(refreshReq.RefreshToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenReused) {
+			c.Logger.Warn().Msg(fmt.Sprintf("refresh token reuse detected for user %s, revoking token family", refresh.User))
+			if err = c.Storage.Sessions.RevokeRefreshFamily(refresh.Family); err != nil {
+				c.Logger.Error().Err(err).Msg("cannot revoke refresh token family")
+			}
+			if err = c.Storage.Sessions.RevokeSession(refresh.User, refresh.Family); err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+				c.Logger.Error().Err(err).Msg("cannot revoke session")
+			}
+			http.Error(res, "refresh token reuse detected", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			c.Logger.Error().Err(err).Msg("unknown refresh token")
+			http.Error(res, "unknown refresh token", http.StatusUnauthorized)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot use refresh token")
+		http.Error(res, "cannot use refresh token", http.StatusInternalServerError)
+		return
+	}
+	if time.Now().After(refresh.ExpiresAt) {
+		c.Logger.Error().Msg("refresh token expired")
+		http.Error(res, "refresh token expired", http.StatusUnauthorized)
+		return
+	}
+	session, err := c.Storage.Sessions.LookupSessionByID(refresh.Family)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			c.Logger.Error().Err(err).Msg("session of refresh token is revoked")
+			http.Error(res, "session of refresh token is revoked", http.StatusUnauthorized)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot lookup session")
+		http.Error(res, "cannot lookup session", http.StatusInternalServerError)
+		return
+	}
+	if err = c.Storage.Sessions.TouchSession(session.ID, time.Now()); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot update session last seen time")
+	}
+	pair, err := c.issueTokenPair(refresh.User, refresh.Family)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot issue tokens")
+		http.Error(res, "cannot issue tokens", http.StatusInternalServerError)
+		return
+	}
+	pairJSON, err := json.Marshal(pair)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot marshal tokens")
+		http.Error(res, "cannot marshal tokens", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.Header().Add("Authorization", pair.Token)
+	res.WriteHeader(http.StatusOK)
+	if _, err = res.Write(pairJSON); err != nil {
+		c.Logger.Error().Err(err).Msg("error in writing response")
+		return
 	}
-	return fmt.Sprintf("%x", sha256.Sum256(data))
 }
 
 func (c *GmartController) getUserWithdrawals(res http.ResponseWriter, req *http.Request) {
-	token := req.Header.Get("Authorization")
-	login := c.findLoginByToken(token)
+	user, _ := middlewares.UserFromContext(req.Context())
+	login := user.Login
 	withdrawals, err := c.Storage.Connector.GetUserWithdrawals(login)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot get user withdrawals")
@@ -334,18 +600,52 @@ func (c *GmartController) getUserWithdrawals(res http.ResponseWriter, req *http.
 	}
 }
 
+func (c *GmartController) getUserAdjustments(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	adjustments, err := c.Storage.Connector.GetUserAdjustments(user.Login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user adjustments")
+		http.Error(res, "cannot get user adjustments", http.StatusInternalServerError)
+		return
+	}
+	if len(adjustments) == 0 {
+		res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for i := range adjustments {
+		adjustments[i].Actor = ""
+	}
+	c.writeJSON(res, http.StatusOK, adjustments)
+}
+
 func (c *GmartController) getUserBalance(res http.ResponseWriter, req *http.Request) {
-	token := req.Header.Get("Authorization")
-	login := c.findLoginByToken(token)
+	user, _ := middlewares.UserFromContext(req.Context())
+	login := user.Login
 	balance, withdrawn, err := c.Storage.Connector.CheckUserBalance(login)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot get user balance")
 		http.Error(res, "cannot get user balance", http.StatusInternalServerError)
 		return
 	}
+	expiring, err := c.Storage.Connector.GetUpcomingExpirations(login, time.Now().Add(c.Config.GetExpiryNotice()))
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get upcoming points expirations")
+		http.Error(res, "cannot get upcoming points expirations", http.StatusInternalServerError)
+		return
+	}
+	pending, held, err := c.Storage.Connector.GetPendingBalance(login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user pending balance")
+		http.Error(res, "cannot get user pending balance", http.StatusInternalServerError)
+		return
+	}
 	bal := storage.Balance{
 		Current:   balance,
 		Withdrawn: withdrawn,
+		Pending:   pending,
+		Held:      held,
+		Expiring:  expiring,
 	}
 	balJSON, err := json.Marshal(bal)
 	if err != nil {
@@ -363,34 +663,44 @@ func (c *GmartController) getUserBalance(res http.ResponseWriter, req *http.Requ
 	}
 }
 
-func (c *GmartController) findLoginByToken(token string) string {
-	for _, val := range c.Storage.Tokens {
-		if val.Token == token {
-			return val.User
-		}
-	}
-	return ""
-}
-
 func (c *GmartController) getUserOrders(res http.ResponseWriter, req *http.Request) {
-	token := req.Header.Get("Authorization")
-	login := c.findLoginByToken(token)
-	if login == "" {
+	user, ok := middlewares.UserFromContext(req.Context())
+	if !ok {
 		c.Logger.Error().Msg("cannot get user login")
-		http.Error(res, "cannot get user login", http.StatusInternalServerError)
+		http.Error(res, "cannot get user login", http.StatusUnauthorized)
 		return
 	}
-	orders, err := c.Storage.Connector.GetUserOrders(login)
-	if orders == nil {
-		c.Logger.Error().Err(err).Msg("no orders found for this user")
-		http.Error(res, "no orders found for this user", http.StatusNoContent)
+	login := user.Login
+	filter, err := orderFilterFromQuery(req)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong orders filter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
+	limit := filter.Limit
+	filter.Limit++
+	orders, err := c.Storage.Connector.GetUserOrders(login, filter)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot get user orders")
 		http.Error(res, "cannot get user orders", http.StatusInternalServerError)
 		return
 	}
+	if orders == nil {
+		c.Logger.Error().Err(err).Msg("no orders found for this user")
+		http.Error(res, "no orders found for this user", http.StatusNoContent)
+		return
+	}
+	if int64(len(orders)) > limit {
+		orders = orders[:limit]
+		last := orders[len(orders)-1]
+		placedAt, err := time.Parse(time.RFC3339Nano, last.Date)
+		if err != nil {
+			c.Logger.Error().Err(err).Msg("cannot parse order upload time")
+			http.Error(res, "cannot parse order upload time", http.StatusInternalServerError)
+			return
+		}
+		setNextCursor(res, req, storage.Cursor{At: placedAt, ID: last.ID})
+	}
 	ordersJSON, err := json.Marshal(orders)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("cannot marshal orders")
@@ -428,12 +738,15 @@ func (c *GmartController) CheckAuth(login string, password string) (bool, error)
 	return exists, nil
 }
 
-func NewGmartController(logger logger.Logger, conf config.Configurator, storage *storage.Storage, cbConnector *cbconnector.CBConnector, status *storage.CurrentStats) *GmartController {
+func NewGmartController(logger logger.Logger, conf config.Configurator, storage *storage.Storage, cbConnector *cbconnector.CBConnector, status *storage.CurrentStats, signer authtokens.Signer, notify notifier.Notifier, policy *credpolicy.Policy) *GmartController {
 	return &GmartController{
 		Logger:   logger,
 		Config:   conf,
 		Storage:  storage,
 		Cashback: cbConnector,
 		Status:   status,
+		Signer:   signer,
+		Notifier: notify,
+		Policy:   policy,
 	}
 }
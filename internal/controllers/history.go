@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (c *GmartController) getUserHistory(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	filter, err := historyFilterFromQuery(req)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong history filter")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := filter.Limit
+	filter.Limit++
+	history, err := c.Storage.Connector.GetUserHistory(user.Login, filter)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		c.Logger.Error().Err(err).Msg("wrong history cursor")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user history")
+		http.Error(res, "cannot get user history", http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 {
+		res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if int64(len(history)) > limit {
+		history = history[:limit]
+		last := history[len(history)-1]
+		setNextCursor(res, req, storage.Cursor{At: last.ProcessedAt, ID: strconv.FormatInt(last.ID, 10)})
+	}
+	c.writeJSON(res, http.StatusOK, history)
+}
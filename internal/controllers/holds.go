@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type holdRequest struct {
+	Login string `json:"login"`
+	withdrawRequest
+}
+
+func (c *GmartController) createHold(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	holdReq := holdRequest{}
+	if err = json.Unmarshal(body, &holdReq); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
+		c.writeFieldErrors(res, http.StatusBadRequest, []fieldError{
+			{Field: "body", Rule: "format", Message: "request body must be a JSON object with login, order and sum"},
+		})
+		return
+	}
+	sum, violations, status := c.validateWithdrawal(holdReq.withdrawRequest)
+	if len(violations) > 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("hold for user %s violates %d rules", holdReq.Login, len(violations)))
+		c.writeFieldErrors(res, status, violations)
+		return
+	}
+	user, err := c.Storage.Connector.GetUser(holdReq.Login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.Logger.Error().Err(err).Msg("user not found")
+			http.Error(res, "user not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot get user")
+		http.Error(res, "cannot get user", http.StatusInternalServerError)
+		return
+	}
+	if user.Blocked {
+		c.Logger.Error().Msg(fmt.Sprintf("hold requested for blocked user %s", user.Login))
+		http.Error(res, "account is blocked", http.StatusForbidden)
+		return
+	}
+	now := time.Now()
+	hold, err := c.Storage.Connector.HoldPoints(req.Context(), storage.Hold{
+		Login:     user.Login,
+		OrderID:   holdReq.Order,
+		Sum:       sum,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.Config.GetHoldTTL()),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("user %s has not enough points to hold %s", user.Login, sum))
+			c.writeFieldErrors(res, http.StatusPaymentRequired, []fieldError{
+				{Field: "sum", Rule: "insufficient_funds", Message: "not enough points on balance"},
+			})
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot hold points")
+		http.Error(res, "cannot hold points", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("held %s points of user %s for order %s", hold.Sum, hold.Login, hold.OrderID))
+	c.writeJSON(res, http.StatusCreated, hold)
+}
+
+func (c *GmartController) captureHold(res http.ResponseWriter, req *http.Request) {
+	c.settleHold(res, req, c.Storage.Connector.CaptureHold)
+}
+
+func (c *GmartController) releaseHold(res http.ResponseWriter, req *http.Request) {
+	c.settleHold(res, req, c.Storage.Connector.ReleaseHold)
+}
+
+func (c *GmartController) settleHold(res http.ResponseWriter, req *http.Request, settle func(ctx context.Context, id int64) (storage.Hold, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong hold id")
+		http.Error(res, "wrong hold id", http.StatusBadRequest)
+		return
+	}
+	hold, err := settle(req.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrHoldNotFound) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("hold %d not found", id))
+			http.Error(res, "hold not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrHoldSettled) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("hold %d already settled with status %s", id, hold.Status))
+			http.Error(res, "hold already captured or released", http.StatusConflict)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot settle hold")
+		http.Error(res, "cannot settle hold", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("hold %d of user %s for order %s is %s", hold.ID, hold.Login, hold.OrderID, hold.Status))
+	c.writeJSON(res, http.StatusOK, hold)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxLoginDelay  = 24 * time.Hour
+	maxDelayShifts = 16
+)
+
+func loginSubject(login string) string {
+	return "login:" + login
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func resetSubject(subject string) string {
+	return "reset:" + subject
+}
+
+func loginDelay(failures int64, maxFailures int64, backoff time.Duration, lockout time.Duration) time.Duration {
+	base, shift := backoff, failures-1
+	if failures >= maxFailures {
+		base, shift = lockout, failures-maxFailures
+	}
+	if shift > maxDelayShifts {
+		shift = maxDelayShifts
+	}
+	delay := base << shift
+	if delay > maxLoginDelay || delay < 0 {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+func setRetryAfter(res http.ResponseWriter, retryAfter time.Duration) {
+	res.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+}
+
+func (c *GmartController) checkLoginAllowed(login string, ip string, now time.Time) (int, time.Duration, error) {
+	return c.checkAttempts(loginSubject(login), ipSubject(ip), now)
+}
+
+func (c *GmartController) registerLoginFailure(login string, ip string, now time.Time) error {
+	return c.registerAttempt(loginSubject(login), ipSubject(ip), now)
+}
+
+func (c *GmartController) checkPasswordResetAllowed(login string, ip string, now time.Time) (int, time.Duration, error) {
+	loginKey, ipKey := resetSubject(loginSubject(login)), resetSubject(ipSubject(ip))
+	status, retryAfter, err := c.checkAttempts(loginKey, ipKey, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if status != 0 {
+		return http.StatusTooManyRequests, retryAfter, nil
+	}
+	return 0, 0, c.registerAttempt(loginKey, ipKey, now)
+}
+
+func (c *GmartController) checkAttempts(loginKey string, ipKey string, now time.Time) (int, time.Duration, error) {
+	limits := c.Config.GetLoginLimits()
+	attempts, err := c.Storage.Connector.GetLoginAttempts(loginKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if now.Before(attempts.BlockedUntil) {
+		if attempts.Failures >= limits.MaxLoginFailures {
+			return http.StatusLocked, attempts.BlockedUntil.Sub(now), nil
+		}
+		return http.StatusTooManyRequests, attempts.BlockedUntil.Sub(now), nil
+	}
+	attempts, err = c.Storage.Connector.GetLoginAttempts(ipKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if now.Before(attempts.BlockedUntil) {
+		return http.StatusTooManyRequests, attempts.BlockedUntil.Sub(now), nil
+	}
+	return 0, 0, nil
+}
+
+func (c *GmartController) registerAttempt(loginKey string, ipKey string, now time.Time) error {
+	limits := c.Config.GetLoginLimits()
+	failures, err := c.Storage.Connector.RegisterLoginFailure(loginKey, now, maxLoginDelay)
+	if err != nil {
+		return err
+	}
+	delay := loginDelay(failures, limits.MaxLoginFailures, limits.Backoff, limits.Lockout)
+	if err = c.Storage.Connector.BlockLoginAttempts(loginKey, now.Add(delay)); err != nil {
+		return err
+	}
+	failures, err = c.Storage.Connector.RegisterLoginFailure(ipKey, now, maxLoginDelay)
+	if err != nil {
+		return err
+	}
+	if failures >= limits.MaxIPFailures {
+		delay = loginDelay(failures, limits.MaxIPFailures, limits.Backoff, limits.Lockout)
+		return c.Storage.Connector.BlockLoginAttempts(ipKey, now.Add(delay))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/config"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func TestLoginDelay(t *testing.T) {
+	const (
+		maxFailures = 5
+		backoff     = time.Second
+		lockout     = 15 * time.Minute
+	)
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 15 * time.Minute},
+		{6, 30 * time.Minute},
+		{8, 2 * time.Hour},
+		{20, maxLoginDelay},
+		{1000, maxLoginDelay},
+	}
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures, maxFailures, backoff, lockout); got != tt.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+type guardTestConfig struct {
+	config.Configurator
+	limits config.LoginLimits
+}
+
+func (g guardTestConfig) GetLoginLimits() config.LoginLimits {
+	return g.limits
+}
+
+type guardTestConnector struct {
+	storage.Connector
+	attempts map[string]storage.LoginAttempts
+}
+
+func (g *guardTestConnector) GetLoginAttempts(subject string) (storage.LoginAttempts, error) {
+	return g.attempts[subject], nil
+}
+
+func (g *guardTestConnector) RegisterLoginFailure(subject string, failedAt time.Time, resetAfter time.Duration) (int64, error) {
+	attempts := g.attempts[subject]
+	attempts.Subject = subject
+	attempts.Failures++
+	attempts.LastFailure = failedAt
+	g.attempts[subject] = attempts
+	return attempts.Failures, nil
+}
+
+func (g *guardTestConnector) BlockLoginAttempts(subject string, until time.Time) error {
+	attempts := g.attempts[subject]
+	attempts.BlockedUntil = until
+	g.attempts[subject] = attempts
+	return nil
+}
+
+func TestCheckPasswordResetAllowed(t *testing.T) {
+	connector := &guardTestConnector{attempts: map[string]storage.LoginAttempts{}}
+	c := &GmartController{
+		Config: guardTestConfig{limits: config.LoginLimits{
+			MaxLoginFailures: 3,
+			MaxIPFailures:    10,
+			Backoff:          time.Second,
+			Lockout:          time.Minute,
+		}},
+		Storage: &storage.Storage{Connector: connector},
+	}
+	now := time.Now()
+	status, _, err := c.checkPasswordResetAllowed("gopher", "10.0.0.1", now)
+	if err != nil || status != 0 {
+		t.Fatalf("first request = %d, %v, want allowed", status, err)
+	}
+	status, retryAfter, err := c.checkPasswordResetAllowed("gopher", "10.0.0.1", now)
+	if err != nil || status != http.StatusTooManyRequests || retryAfter != time.Second {
+		t.Fatalf("repeated request = %d, %s, %v, want %d after 1s", status, retryAfter, err, http.StatusTooManyRequests)
+	}
+	if _, ok := connector.attempts[loginSubject("gopher")]; ok {
+		t.Error("password reset requests must not count as login failures")
+	}
+	status, _, err = c.checkPasswordResetAllowed("gopher", "10.0.0.1", now.Add(time.Second))
+	if err != nil || status != 0 {
+		t.Fatalf("request after backoff = %d, %v, want allowed", status, err)
+	}
+	status, _, err = c.checkPasswordResetAllowed("gopher", "10.0.0.1", now.Add(2*time.Second))
+	if err != nil || status != http.StatusTooManyRequests {
+		t.Fatalf("request within doubled backoff = %d, %v, want %d", status, err, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func queryInt(req *http.Request, name string, def int64, max int64) (int64, error) {
+	raw := req.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("wrong %s parameter %q", name, raw)
+	}
+	if max > 0 && val > max {
+		return max, nil
+	}
+	return val, nil
+}
+
+func queryTime(req *http.Request, name string) (time.Time, error) {
+	raw := req.URL.Query().Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	val, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		val, err = time.Parse("2006-01-02", raw)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("wrong %s parameter %q", name, raw)
+	}
+	return val, nil
+}
+
+func querySortDesc(req *http.Request, def bool) (bool, error) {
+	switch raw := req.URL.Query().Get("sort"); raw {
+	case "":
+		return def, nil
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, fmt.Errorf("wrong sort parameter %q", raw)
+	}
+}
+
+func queryCursor(req *http.Request) (*storage.Cursor, error) {
+	raw := req.URL.Query().Get("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	cursor, err := storage.DecodeCursor(raw)
+	if err != nil {
+		return nil, fmt.Errorf("wrong cursor parameter %q", raw)
+	}
+	return &cursor, nil
+}
+
+type pageParams struct {
+	From  time.Time
+	To    time.Time
+	Desc  bool
+	Limit int64
+	After *storage.Cursor
+}
+
+func pageFromQuery(req *http.Request) (pageParams, error) {
+	var (
+		page pageParams
+		err  error
+	)
+	if page.Limit, err = queryInt(req, "limit", 100, 500); err != nil {
+		return page, err
+	}
+	if page.Limit == 0 {
+		return page, fmt.Errorf("wrong limit parameter %q", req.URL.Query().Get("limit"))
+	}
+	if page.From, err = queryTime(req, "from"); err != nil {
+		return page, err
+	}
+	if page.To, err = queryTime(req, "to"); err != nil {
+		return page, err
+	}
+	if page.Desc, err = querySortDesc(req, false); err != nil {
+		return page, err
+	}
+	if page.After, err = queryCursor(req); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+func queryList(req *http.Request, name string, allowed map[string]struct{}, normalize func(string) string) ([]string, error) {
+	raw := req.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	var values []string
+	for _, val := range strings.Split(raw, ",") {
+		val = normalize(strings.TrimSpace(val))
+		if _, ok := allowed[val]; !ok {
+			return nil, fmt.Errorf("wrong %s parameter %q", name, val)
+		}
+		values = append(values, val)
+	}
+	return values, nil
+}
+
+func orderFilterFromQuery(req *http.Request) (storage.OrderFilter, error) {
+	page, err := pageFromQuery(req)
+	if err != nil {
+		return storage.OrderFilter{}, err
+	}
+	statuses, err := queryList(req, "status", storage.OrderStatuses, strings.ToUpper)
+	if err != nil {
+		return storage.OrderFilter{}, err
+	}
+	return storage.OrderFilter{
+		Statuses: statuses,
+		From:     page.From,
+		To:       page.To,
+		Desc:     page.Desc,
+		Limit:    page.Limit,
+		After:    page.After,
+	}, nil
+}
+
+func historyFilterFromQuery(req *http.Request) (storage.HistoryFilter, error) {
+	page, err := pageFromQuery(req)
+	if err != nil {
+		return storage.HistoryFilter{}, err
+	}
+	kinds, err := queryList(req, "type", storage.HistoryKinds, strings.ToLower)
+	if err != nil {
+		return storage.HistoryFilter{}, err
+	}
+	return storage.HistoryFilter{
+		Kinds: kinds,
+		From:  page.From,
+		To:    page.To,
+		Desc:  page.Desc,
+		Limit: page.Limit,
+		After: page.After,
+	}, nil
+}
+
+func setNextCursor(res http.ResponseWriter, req *http.Request, cursor storage.Cursor) {
+	next := *req.URL
+	query := next.Query()
+	query.Set("cursor", cursor.Encode())
+	next.RawQuery = query.Encode()
+	res.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	res.Header().Set("X-Next-Cursor", cursor.Encode())
+}
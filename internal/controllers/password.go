@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/auth_tokens"
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (c *GmartController) changePassword(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	change := storage.PasswordChange{}
+	err = json.Unmarshal(body, &change)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
+		http.Error(res, "cannot unmarshal request body", http.StatusBadRequest)
+		return
+	}
+	if change.OldPassword == "" || change.NewPassword == "" {
+		c.Logger.Error().Msg("old or new password missing in body")
+		http.Error(res, "old or new password missing in body", http.StatusBadRequest)
+		return
+	}
+	if violations := c.Policy.CheckPassword(user.Login, change.NewPassword); len(violations) > 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("new password of user %s violates %d policy rules", user.Login, len(violations)))
+		c.writeFieldErrors(res, http.StatusBadRequest, policyErrors(violations))
+		return
+	}
+	auth, err := c.Storage.Connector.CheckUserCreds(user.Login, change.OldPassword)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot check provided credentials")
+		http.Error(res, "cannot check provided credentials", http.StatusInternalServerError)
+		return
+	}
+	if !auth {
+		c.Logger.Error().Msg("old password is incorrect")
+		http.Error(res, "old password is incorrect", http.StatusForbidden)
+		return
+	}
+	_, err = c.Storage.Connector.UpdateUserPassword(user.Login, change.NewPassword)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot update user password")
+		http.Error(res, "cannot update user password", http.StatusInternalServerError)
+		return
+	}
+	revoked, err := c.Storage.Sessions.RevokeUserSessions(user.Login, user.SessionID)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("password changed, but can't revoke other sessions")
+		http.Error(res, "password changed, but can't revoke other sessions", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("password of user %s changed, %d other sessions revoked", user.Login, revoked))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) requestPasswordReset(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	resetReq := storage.PasswordResetRequest{}
+	err = json.Unmarshal(body, &resetReq)
+	if err != nil || resetReq.Login == "" {
+		c.Logger.Error().Err(err).Msg("login missing in body")
+		http.Error(res, "login missing in body", http.StatusBadRequest)
+		return
+	}
+	ip := clientIP(req)
+	status, retryAfter, err := c.checkPasswordResetAllowed(resetReq.Login, ip, time.Now())
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot check password reset attempts")
+		http.Error(res, "cannot check password reset attempts", http.StatusInternalServerError)
+		return
+	}
+	if status != 0 {
+		c.Logger.Warn().Msg(fmt.Sprintf("password reset for %s from %s rejected, retry after %s", resetReq.Login, ip, retryAfter))
+		setRetryAfter(res, retryAfter)
+		http.Error(res, "too many password reset requests", status)
+		return
+	}
+	exists, err := c.Storage.Connector.UserExists(resetReq.Login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot check user existence")
+		http.Error(res, "cannot check user existence", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		token, err := authtokens.GenerateToken()
+		if err != nil {
+			c.Logger.Error().Err(err).Msg("cannot generate reset token")
+			http.Error(res, "cannot generate reset token", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		reset := storage.PasswordReset{
+			Token:     token,
+			Login:     resetReq.Login,
+			Created:   now,
+			ExpiresAt: now.Add(c.Config.GetResetTTL()),
+		}
+		if err = c.Storage.Connector.IssuePasswordReset(reset); err != nil {
+			c.Logger.Error().Err(err).Msg("cannot store reset token")
+			http.Error(res, "cannot store reset token", http.StatusInternalServerError)
+			return
+		}
+		if err = c.Notifier.NotifyPasswordReset(reset.Login, reset.Token, reset.ExpiresAt); err != nil {
+			c.Logger.Error().Err(err).Msg("cannot deliver reset token")
+			http.Error(res, "cannot deliver reset token", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		c.Logger.Warn().Msg(fmt.Sprintf("password reset requested for unknown user %s", resetReq.Login))
+	}
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusAccepted)
+}
+
+func (c *GmartController) confirmPasswordReset(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	resetReq := storage.PasswordResetRequest{}
+	err = json.Unmarshal(body, &resetReq)
+	if err != nil || resetReq.Token == "" || resetReq.NewPassword == "" {
+		c.Logger.Error().Err(err).Msg("token or new password missing in body")
+		http.Error(res, "token or new password missing in body", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	reset, err := c.Storage.Connector.GetPasswordReset(resetReq.Token, now)
+	if err != nil {
+		if errors.Is(err, storage.ErrResetTokenInvalid) {
+			c.Logger.Error().Err(err).Msg("password reset token rejected")
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot get reset token")
+		http.Error(res, "cannot get reset token", http.StatusInternalServerError)
+		return
+	}
+	if violations := c.Policy.CheckPassword(reset.Login, resetReq.NewPassword); len(violations) > 0 {
+		c.Logger.Error().Msg(fmt.Sprintf("new password violates %d policy rules", len(violations)))
+		c.writeFieldErrors(res, http.StatusBadRequest, policyErrors(violations))
+		return
+	}
+	reset, err = c.Storage.Connector.UsePasswordReset(resetReq.Token, now, resetReq.NewPassword)
+	if err != nil {
+		if errors.Is(err, storage.ErrResetTokenInvalid) {
+			c.Logger.Error().Err(err).Msg("password reset token rejected")
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot reset user password")
+		http.Error(res, "cannot reset user password", http.StatusInternalServerError)
+		return
+	}
+	if _, err = c.Storage.Sessions.RevokeUserSessions(reset.Login, ""); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot revoke user sessions")
+	}
+	if err = c.Storage.Connector.ResetLoginAttempts(loginSubject(reset.Login)); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot reset login attempts")
+	}
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
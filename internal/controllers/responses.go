@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/cred_policy"
+)
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type fieldErrorsResponse struct {
+	Errors []fieldError `json:"errors"`
+}
+
+func policyErrors(violations []credpolicy.Violation) []fieldError {
+	errs := make([]fieldError, 0, len(violations))
+	for _, violation := range violations {
+		errs = append(errs, fieldError{Field: violation.Field, Rule: violation.Rule, Message: violation.Message})
+	}
+	return errs
+}
+
+func (c *GmartController) writeFieldErrors(res http.ResponseWriter, status int, errs []fieldError) {
+	c.writeJSON(res, status, fieldErrorsResponse{Errors: errs})
+}
+
+func (c *GmartController) writeJSON(res http.ResponseWriter, status int, body any) {
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot marshal response")
+		http.Error(res, "cannot marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(status)
+	if _, err = res.Write(bodyJSON); err != nil {
+		c.Logger.Error().Err(err).Msg("error in writing response")
+		return
+	}
+}
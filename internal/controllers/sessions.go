@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func (c *GmartController) logoutUser(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	err := c.Storage.Sessions.RevokeSession(user.Login, user.SessionID)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot revoke session")
+		http.Error(res, "cannot revoke session", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) logoutUserEverywhere(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	revoked, err := c.Storage.Sessions.RevokeUserSessions(user.Login, "")
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot revoke user sessions")
+		http.Error(res, "cannot revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf("%d sessions of user %s revoked", revoked, user.Login))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
+
+func (c *GmartController) getUserSessions(res http.ResponseWriter, req *http.Request) {
+	current, _ := middlewares.UserFromContext(req.Context())
+	sessions, err := c.Storage.Sessions.GetUserSessions(current.Login)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get user sessions")
+		http.Error(res, "cannot get user sessions", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]storage.SessionInfo, 0, len(sessions))
+	for _, val := range sessions {
+		infos = append(infos, storage.SessionInfo{
+			ID:        val.ID,
+			UserAgent: val.UserAgent,
+			IP:        val.IP,
+			Created:   val.Created,
+			LastSeen:  val.LastSeen,
+			Current:   val.ID == current.SessionID,
+		})
+	}
+	infosJSON, err := json.Marshal(infos)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot marshal sessions")
+		http.Error(res, "cannot marshal sessions", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+	if _, err = res.Write(infosJSON); err != nil {
+		c.Logger.Error().Err(err).Msg("error in writing response")
+		return
+	}
+}
+
+func (c *GmartController) revokeUserSession(res http.ResponseWriter, req *http.Request) {
+	current, _ := middlewares.UserFromContext(req.Context())
+	err := c.Storage.Sessions.RevokeSession(current.Login, chi.URLParam(req, "id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			c.Logger.Error().Err(err).Msg("session not found")
+			http.Error(res, "session not found", http.StatusNotFound)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot revoke session")
+		http.Error(res, "cannot revoke session", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+}
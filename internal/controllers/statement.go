@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+const statementFlushEvery = 100
+
+type statementSummary struct {
+	Record  string                   `json:"record"`
+	From    time.Time                `json:"from"`
+	To      time.Time                `json:"to"`
+	Opening storage.Money            `json:"opening_balance"`
+	Closing storage.Money            `json:"closing_balance"`
+	Orders  int64                    `json:"orders"`
+	Totals  map[string]storage.Money `json:"totals"`
+}
+
+type statementWriter interface {
+	Opening(summary statementSummary) error
+	Row(row storage.StatementRow) error
+	Summary(summary statementSummary) error
+	Flush() error
+}
+
+type csvStatementWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvStatementWriter) Opening(summary statementSummary) error {
+	if err := w.writer.Write([]string{"record", "date", "type", "order", "status", "accrual", "amount", "balance"}); err != nil {
+		return err
+	}
+	return w.writer.Write([]string{"opening_balance", summary.From.Format(time.RFC3339), "", "", "", "", "", summary.Opening.String()})
+}
+
+func (w *csvStatementWriter) Row(row storage.StatementRow) error {
+	accrual, balance := "", ""
+	if row.Record == storage.StatementOrder {
+		accrual = row.Accrual.String()
+	} else {
+		balance = row.Balance.String()
+	}
+	return w.writer.Write([]string{
+		row.Record,
+		row.Date.Format(time.RFC3339),
+		row.Type,
+		row.OrderID,
+		row.Status,
+		accrual,
+		row.Amount.String(),
+		balance,
+	})
+}
+
+func (w *csvStatementWriter) Summary(summary statementSummary) error {
+	kinds := make([]string, 0, len(summary.Totals))
+	for kind := range summary.Totals {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	to := summary.To.Format(time.RFC3339)
+	if err := w.writer.Write([]string{"total", to, storage.StatementOrder, "", "", "", strconv.FormatInt(summary.Orders, 10), ""}); err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		if err := w.writer.Write([]string{"total", to, kind, "", "", "", summary.Totals[kind].String(), ""}); err != nil {
+			return err
+		}
+	}
+	return w.writer.Write([]string{"closing_balance", to, "", "", "", "", "", summary.Closing.String()})
+}
+
+func (w *csvStatementWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonlStatementWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlStatementWriter) Opening(summary statementSummary) error {
+	return w.encoder.Encode(map[string]any{
+		"record":  "opening_balance",
+		"date":    summary.From,
+		"balance": summary.Opening,
+	})
+}
+
+func (w *jsonlStatementWriter) Row(row storage.StatementRow) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonlStatementWriter) Summary(summary statementSummary) error {
+	return w.encoder.Encode(summary)
+}
+
+func (w *jsonlStatementWriter) Flush() error {
+	return nil
+}
+
+func (c *GmartController) getUserStatement(res http.ResponseWriter, req *http.Request) {
+	user, _ := middlewares.UserFromContext(req.Context())
+	from, err := queryTime(req, "from")
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong statement period")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := queryTime(req, "to")
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("wrong statement period")
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from.IsZero() {
+		from = time.Unix(0, 0).UTC()
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.Before(to) {
+		c.Logger.Error().Msg(fmt.Sprintf("wrong statement period from %s to %s", from, to))
+		http.Error(res, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	var (
+		writer      statementWriter
+		contentType string
+	)
+	format := req.URL.Query().Get("format")
+	switch format {
+	case "", "csv":
+		format, contentType = "csv", "text/csv"
+		writer = &csvStatementWriter{writer: csv.NewWriter(res)}
+	case "jsonl":
+		contentType = "application/x-ndjson"
+		writer = &jsonlStatementWriter{encoder: json.NewEncoder(res)}
+	default:
+		c.Logger.Error().Msg(fmt.Sprintf("wrong statement format %q", format))
+		http.Error(res, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	opening, err := c.Storage.Connector.GetBalanceAt(user.Login, from)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot get opening balance")
+		http.Error(res, "cannot get opening balance", http.StatusInternalServerError)
+		return
+	}
+	summary := statementSummary{
+		Record:  "summary",
+		From:    from,
+		To:      to,
+		Opening: opening,
+		Closing: opening,
+		Totals:  map[string]storage.Money{},
+	}
+	res.Header().Add("Content-Type", contentType)
+	res.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement.%s\"", format))
+	res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+	res.WriteHeader(http.StatusOK)
+	flusher, _ := res.(http.Flusher)
+	if err = writer.Opening(summary); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot write statement")
+		return
+	}
+	var written int64
+	err = c.Storage.Connector.StreamUserStatement(req.Context(), user.Login, from, to, func(row storage.StatementRow) error {
+		if row.Record == storage.StatementOrder {
+			summary.Orders++
+		} else {
+			summary.Closing += row.Amount
+			summary.Totals[row.Type] += row.Amount
+		}
+		row.Balance = summary.Closing
+		if err := writer.Row(row); err != nil {
+			return err
+		}
+		written++
+		if written%statementFlushEvery == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.Logger.Error().Err(err).Msg(fmt.Sprintf("statement of user %s interrupted after %d rows", user.Login, written))
+		return
+	}
+	if err = writer.Summary(summary); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot write statement summary")
+		return
+	}
+	if err = writer.Flush(); err != nil {
+		c.Logger.Error().Err(err).Msg("cannot flush statement")
+	}
+}
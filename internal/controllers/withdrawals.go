@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/middlewares"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/ShiraazMoollatjie/goluhn"
+	"github.com/go-chi/chi/v5"
+)
+
+type withdrawRequest struct {
+	Order string          `json:"order"`
+	Sum   json.RawMessage `json:"sum"`
+}
+
+func (c *GmartController) withdrawLimits() (storage.Money, storage.Money) {
+	limits := c.Config.GetWithdrawLimits()
+	return storage.Money(limits.MaxSum * storage.MoneyScale), storage.Money(limits.DailyLimit * storage.MoneyScale)
+}
+
+func (c *GmartController) validateWithdrawal(withdraw withdrawRequest) (storage.Money, []fieldError, int) {
+	var violations []fieldError
+	status := http.StatusUnprocessableEntity
+	if withdraw.Order == "" {
+		violations = append(violations, fieldError{Field: "order", Rule: "required", Message: "order number is required"})
+	} else if err := goluhn.Validate(withdraw.Order); err != nil {
+		violations = append(violations, fieldError{Field: "order", Rule: "luhn", Message: "order number fails Luhn check"})
+	}
+	rawSum := strings.Trim(string(withdraw.Sum), `"`)
+	if rawSum == "" || rawSum == "null" {
+		violations = append(violations, fieldError{Field: "sum", Rule: "required", Message: "sum is required"})
+		return 0, violations, http.StatusBadRequest
+	}
+	sum, err := storage.ParseMoney(rawSum)
+	switch {
+	case errors.Is(err, storage.ErrMoneyPrecision):
+		violations = append(violations, fieldError{Field: "sum", Rule: "max_decimals", Message: fmt.Sprintf("sum must have at most %d decimal places", storage.MoneyDecimals)})
+		status = http.StatusBadRequest
+	case err != nil:
+		violations = append(violations, fieldError{Field: "sum", Rule: "format", Message: "sum must be a number"})
+		status = http.StatusBadRequest
+	case sum <= 0:
+		violations = append(violations, fieldError{Field: "sum", Rule: "positive", Message: "sum must be greater than zero"})
+		status = http.StatusBadRequest
+	}
+	if maxSum, _ := c.withdrawLimits(); err == nil && maxSum > 0 && sum > maxSum {
+		violations = append(violations, fieldError{Field: "sum", Rule: "max", Message: fmt.Sprintf("sum must not exceed %s", maxSum)})
+		status = http.StatusBadRequest
+	}
+	return sum, violations, status
+}
+
+func (c *GmartController) reverseWithdrawal(res http.ResponseWriter, req *http.Request) {
+	actor, _ := middlewares.UserFromContext(req.Context())
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		c.Logger.Error().Err(err).Msg("cannot read request body")
+		http.Error(res, "cannot read request body", http.StatusInternalServerError)
+		return
+	}
+	reversal := storage.Reversal{Reason: "order_cancelled"}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &reversal); err != nil {
+			c.Logger.Error().Err(err).Msg("cannot unmarshal request body")
+			http.Error(res, "cannot unmarshal request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, ok := storage.ReversalReasons[reversal.Reason]; !ok {
+		c.Logger.Error().Msg(fmt.Sprintf("unknown reversal reason %q", reversal.Reason))
+		http.Error(res, "unknown reversal reason", http.StatusUnprocessableEntity)
+		return
+	}
+	reversal.OrderID = chi.URLParam(req, "order")
+	reversal.Actor = actor.Login
+	reversal.ProcessedAt = time.Now().Format(time.RFC3339)
+	withdrawal, err := c.Storage.Connector.ReverseWithdrawal(req.Context(), reversal)
+	if err != nil {
+		if errors.Is(err, storage.ErrWithdrawalNotFound) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("withdrawal for order %s not found", reversal.OrderID))
+			http.Error(res, "withdrawal not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrAlreadyReversed) {
+			c.Logger.Error().Err(err).Msg(fmt.Sprintf("withdrawal for order %s already reversed", reversal.OrderID))
+			http.Error(res, "withdrawal already reversed", http.StatusConflict)
+			return
+		}
+		c.Logger.Error().Err(err).Msg("cannot reverse withdrawal")
+		http.Error(res, "cannot reverse withdrawal", http.StatusInternalServerError)
+		return
+	}
+	c.Logger.Info().Msg(fmt.Sprintf(
+		"%s reversed withdrawal of %s for order %s of user %s with reason %s",
+		actor.Login,
+		withdrawal.Sum,
+		withdrawal.OrderID,
+		withdrawal.Login,
+		reversal.Reason,
+	))
+	c.writeJSON(res, http.StatusOK, withdrawal)
+}
@@ -0,0 +1,198 @@
+package credpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ClassLower   = "lower"
+	ClassUpper   = "upper"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Options struct {
+	PasswordMinLength   int
+	PasswordClasses     string
+	CommonPasswordsFile string
+	LoginMinLength      int
+	LoginMaxLength      int
+	LoginPattern        string
+	ReservedLogins      string
+}
+
+type Policy struct {
+	PasswordMinLength int
+	PasswordClasses   []string
+	CommonPasswords   map[string]struct{}
+	LoginMinLength    int
+	LoginMaxLength    int
+	LoginPattern      *regexp.Regexp
+	ReservedLogins    map[string]struct{}
+}
+
+var classCheckers = map[string]func(r rune) bool{
+	ClassLower: unicode.IsLower,
+	ClassUpper: unicode.IsUpper,
+	ClassDigit: unicode.IsDigit,
+	ClassSpecial: func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	},
+}
+
+func (p *Policy) CheckLogin(login string) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(login)
+	if length < p.LoginMinLength {
+		violations = append(violations, Violation{
+			Field:   "login",
+			Rule:    "min_length",
+			Message: fmt.Sprintf("login must be at least %d characters long", p.LoginMinLength),
+		})
+	}
+	if p.LoginMaxLength > 0 && length > p.LoginMaxLength {
+		violations = append(violations, Violation{
+			Field:   "login",
+			Rule:    "max_length",
+			Message: fmt.Sprintf("login must be at most %d characters long", p.LoginMaxLength),
+		})
+	}
+	if p.LoginPattern != nil && login != "" && !p.LoginPattern.MatchString(login) {
+		violations = append(violations, Violation{
+			Field:   "login",
+			Rule:    "charset",
+			Message: fmt.Sprintf("login must match %s", p.LoginPattern.String()),
+		})
+	}
+	if _, ok := p.ReservedLogins[strings.ToLower(login)]; ok {
+		violations = append(violations, Violation{
+			Field:   "login",
+			Rule:    "reserved",
+			Message: "login is reserved",
+		})
+	}
+	return violations
+}
+
+func (p *Policy) CheckPassword(login string, password string) []Violation {
+	var violations []Violation
+	if utf8.RuneCountInString(password) < p.PasswordMinLength {
+		violations = append(violations, Violation{
+			Field:   "password",
+			Rule:    "min_length",
+			Message: fmt.Sprintf("password must be at least %d characters long", p.PasswordMinLength),
+		})
+	}
+	for _, class := range p.PasswordClasses {
+		if strings.IndexFunc(password, classCheckers[class]) < 0 {
+			violations = append(violations, Violation{
+				Field:   "password",
+				Rule:    "class_" + class,
+				Message: fmt.Sprintf("password must contain at least one %s character", class),
+			})
+		}
+	}
+	if _, ok := p.CommonPasswords[strings.ToLower(password)]; ok {
+		violations = append(violations, Violation{
+			Field:   "password",
+			Rule:    "common",
+			Message: "password is too common",
+		})
+	}
+	if login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		violations = append(violations, Violation{
+			Field:   "password",
+			Rule:    "contains_login",
+			Message: "password must not contain login",
+		})
+	}
+	return violations
+}
+
+func (p *Policy) Check(login string, password string) []Violation {
+	return append(p.CheckLogin(login), p.CheckPassword(login, password)...)
+}
+
+func loadCommonPasswords(path string) (map[string]struct{}, error) {
+	passwords := make(map[string]struct{})
+	if path == "" {
+		return passwords, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func NewPolicy(opts Options) (*Policy, error) {
+	policy := &Policy{
+		PasswordMinLength: opts.PasswordMinLength,
+		LoginMinLength:    opts.LoginMinLength,
+		LoginMaxLength:    opts.LoginMaxLength,
+		ReservedLogins:    make(map[string]struct{}),
+	}
+	if policy.PasswordMinLength < 1 {
+		policy.PasswordMinLength = 1
+	}
+	if policy.LoginMinLength < 1 {
+		policy.LoginMinLength = 1
+	}
+	for _, class := range splitList(opts.PasswordClasses) {
+		if _, ok := classCheckers[class]; !ok {
+			return nil, fmt.Errorf("unknown password character class %s", class)
+		}
+		policy.PasswordClasses = append(policy.PasswordClasses, class)
+	}
+	for _, login := range splitList(opts.ReservedLogins) {
+		policy.ReservedLogins[login] = struct{}{}
+	}
+	if opts.LoginPattern != "" {
+		pattern, err := regexp.Compile(opts.LoginPattern)
+		if err != nil {
+			return nil, err
+		}
+		policy.LoginPattern = pattern
+	}
+	passwords, err := loadCommonPasswords(opts.CommonPasswordsFile)
+	if err != nil {
+		return nil, err
+	}
+	policy.CommonPasswords = passwords
+	return policy, nil
+}
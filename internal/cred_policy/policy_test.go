@@ -0,0 +1,119 @@
+package credpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func rules(violations []Violation) []string {
+	var result []string
+	for _, violation := range violations {
+		result = append(result, violation.Field+":"+violation.Rule)
+	}
+	return result
+}
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	common := filepath.Join(t.TempDir(), "common.txt")
+	if err := os.WriteFile(common, []byte("# top passwords\nPassword1!\n\nqwerty\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPolicy(Options{
+		PasswordMinLength:   8,
+		PasswordClasses:     "lower, upper,digit",
+		CommonPasswordsFile: common,
+		LoginMinLength:      3,
+		LoginMaxLength:      12,
+		LoginPattern:        `^[a-z0-9_]+$`,
+		ReservedLogins:      "admin, Support",
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	return policy
+}
+
+func TestPolicyCheckLogin(t *testing.T) {
+	policy := newTestPolicy(t)
+	tests := []struct {
+		login string
+		want  []string
+	}{
+		{"gopher_1", nil},
+		{"go", []string{"login:min_length"}},
+		{"a_very_long_login", []string{"login:max_length"}},
+		{"Gopher", []string{"login:charset"}},
+		{"support", []string{"login:reserved"}},
+		{"", []string{"login:min_length"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			if got := rules(policy.CheckLogin(tt.login)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckLogin(%q) = %v, want %v", tt.login, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckPassword(t *testing.T) {
+	policy := newTestPolicy(t)
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     []string
+	}{
+		{"strong", "gopher", "Str0ngPass", nil},
+		{"too short", "gopher", "Sh0rt", []string{"password:min_length"}},
+		{"missing classes", "gopher", "alllowercase", []string{"password:class_upper", "password:class_digit"}},
+		{"common", "gopher", "pASSWORD1!", []string{"password:common"}},
+		{"contains login", "gopher", "MyGopher123", []string{"password:contains_login"}},
+		{"empty login skips login rule", "", "MyGopher123", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules(policy.CheckPassword(tt.login, tt.password)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckPassword(%q, %q) = %v, want %v", tt.login, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckCombinesLoginAndPassword(t *testing.T) {
+	policy := newTestPolicy(t)
+	want := []string{"login:reserved", "password:contains_login"}
+	if got := rules(policy.Check("admin", "Admin12345")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"unknown class", Options{PasswordClasses: "lower,emoji"}},
+		{"bad pattern", Options{LoginPattern: "["}},
+		{"missing common passwords file", Options{CommonPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicy(tt.opts); err == nil {
+				t.Error("NewPolicy() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewPolicyMinimumLengths(t *testing.T) {
+	policy, err := NewPolicy(Options{})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if policy.PasswordMinLength != 1 || policy.LoginMinLength != 1 {
+		t.Errorf("minimum lengths = %d/%d, want 1/1", policy.PasswordMinLength, policy.LoginMinLength)
+	}
+}
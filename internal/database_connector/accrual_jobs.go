@@ -0,0 +1,123 @@
+package dbconnector
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+const accrualJobColumns = "J.order_id,O.login,O.status,O.placed_at,J.attempts,J.next_attempt_at,J.last_error,J.created_at,J.dead_at"
+
+type SQLAccrualJobOps struct {
+	Logger logger.Logger
+	DBConn *sql.DB
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccrualJob(row rowScanner) (storage.AccrualJob, error) {
+	var (
+		job    storage.AccrualJob
+		deadAt sql.NullTime
+	)
+	err := row.Scan(
+		&job.OrderID,
+		&job.Login,
+		&job.Status,
+		&job.PlacedAt,
+		&job.Attempts,
+		&job.NextAttemptAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&deadAt,
+	)
+	job.State = storage.AccrualJobPending
+	if deadAt.Valid {
+		job.DeadAt = &deadAt.Time
+		job.State = storage.AccrualJobDead
+	}
+	return job, err
+}
+
+func (pg *SQLAccrualJobOps) queryAccrualJobs(query string, args ...any) ([]storage.AccrualJob, error) {
+	rows, cancel, err := makeQueryContext(pg.DBConn, query, args...)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query accrual jobs from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []storage.AccrualJob
+	for rows.Next() {
+		job, err := scanAccrualJob(rows)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (pg *SQLAccrualJobOps) LeaseAccrualJobs(now time.Time, lease time.Duration, limit int64) ([]storage.AccrualJob, error) {
+	return pg.queryAccrualJobs(
+		"UPDATE ACCRUAL_JOBS J SET next_attempt_at=$2 FROM ORDERS O WHERE O.id=J.order_id AND J.order_id IN ("+
+			"SELECT order_id FROM ACCRUAL_JOBS WHERE dead_at IS NULL AND next_attempt_at<=$1 "+
+			"ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED"+
+			") RETURNING "+accrualJobColumns,
+		now, now.Add(lease), limit,
+	)
+}
+
+func (pg *SQLAccrualJobOps) UpdateAccrualJob(job storage.AccrualJob) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE ACCRUAL_JOBS SET attempts=$2,next_attempt_at=$3,last_error=$4,dead_at=$5 WHERE order_id=$1",
+		job.OrderID, job.Attempts, job.NextAttemptAt, job.LastError, job.DeadAt,
+	)
+	defer cancel()
+	return err
+}
+
+func (pg *SQLAccrualJobOps) GetAccrualJobs(dead bool, limit int64, offset int64) ([]storage.AccrualJob, error) {
+	if dead {
+		return pg.queryAccrualJobs(
+			"SELECT "+accrualJobColumns+" FROM ACCRUAL_JOBS J JOIN ORDERS O ON O.id=J.order_id "+
+				"WHERE J.dead_at IS NOT NULL ORDER BY J.dead_at DESC, J.order_id LIMIT $1 OFFSET $2",
+			limit, offset,
+		)
+	}
+	return pg.queryAccrualJobs(
+		"SELECT "+accrualJobColumns+" FROM ACCRUAL_JOBS J JOIN ORDERS O ON O.id=J.order_id "+
+			"WHERE J.dead_at IS NULL ORDER BY J.next_attempt_at, J.order_id LIMIT $1 OFFSET $2",
+		limit, offset,
+	)
+}
+
+func (pg *SQLAccrualJobOps) RequeueAccrualJob(orderID string, now time.Time) (storage.AccrualJob, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"UPDATE ACCRUAL_JOBS J SET attempts=0,next_attempt_at=$2,created_at=$2,dead_at=NULL "+
+			"FROM ORDERS O WHERE O.id=J.order_id AND J.order_id=$1 RETURNING "+accrualJobColumns,
+		orderID, now,
+	)
+	defer cancel()
+	job, err := scanAccrualJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, storage.ErrAccrualJobNotFound
+	}
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when requeue accrual job")
+	}
+	return job, err
+}
@@ -0,0 +1,105 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (pg *SQLBonusOps) ApplyAccrual(ctx context.Context, orderID string, status string, accrual storage.Money) (storage.Order, bool, error) {
+	var (
+		order    storage.Order
+		credited bool
+	)
+	err := makeTxContext(ctx, pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		var placedAt time.Time
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT id,cashback,placed_at,login,status FROM ORDERS WHERE id=$1 FOR UPDATE",
+			orderID,
+		).Scan(&order.ID, &order.Accrual, &placedAt, &order.Login, &order.Status)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrOrderNotFound
+			}
+			return err
+		}
+		order.Date = placedAt.Format(time.RFC3339)
+		if !storage.OrderFinal(order.Status) {
+			_, err = tx.ExecContext(ctx, "UPDATE ORDERS SET cashback=$2,status=$3 WHERE id=$1", orderID, accrual, status)
+			if err != nil {
+				return err
+			}
+			order.Accrual, order.Status = accrual, status
+			if status == "PROCESSED" && accrual > 0 {
+				entry := storage.NewUserEntry(storage.BonusAccrual, order.Login, orderID, accrual, time.Now().Format(time.RFC3339))
+				var entryID int64
+				err = tx.QueryRowContext(
+					ctx,
+					"SELECT id FROM BONUSES WHERE order_id=$1 AND kind=$2",
+					orderID, storage.BonusAccrual,
+				).Scan(&entryID)
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					if _, err = postLedgerEntryTx(ctx, tx, entry, pg.lotTTL); err != nil {
+						return err
+					}
+					credited = true
+				case err != nil:
+					return err
+				}
+			}
+		}
+		if storage.OrderFinal(order.Status) {
+			_, err = tx.ExecContext(ctx, "DELETE FROM ACCRUAL_JOBS WHERE order_id=$1", orderID)
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, storage.ErrOrderNotFound) {
+		pg.Logger.Error().Err(err).Msg("error when applying accrual")
+	}
+	return order, credited, err
+}
+
+func (pg *SQLBonusOps) GetAccrualMismatches() ([]storage.AccrualMismatch, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		`SELECT O.id,O.login,O.status,O.cashback,COALESCE(L.credited,0)::bigint
+		FROM ORDERS O LEFT JOIN (
+			SELECT B.order_id,SUM(P.amount) AS credited
+			FROM BONUSES B
+			JOIN POSTINGS P ON P.entry_id=B.id
+			JOIN ACCOUNTS A ON A.id=P.account_id AND A.code=$1||B.login
+			WHERE B.kind=$2
+			GROUP BY B.order_id
+		) L ON L.order_id=O.id
+		WHERE (O.status='PROCESSED' AND O.cashback<>COALESCE(L.credited,0))
+		OR (O.status<>'PROCESSED' AND L.credited IS NOT NULL)
+		ORDER BY O.placed_at,O.id`,
+		storage.UserAccount(""), storage.BonusAccrual,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query accrual mismatches from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	var mismatches []storage.AccrualMismatch
+	for rows.Next() {
+		var mismatch storage.AccrualMismatch
+		err = rows.Scan(&mismatch.OrderID, &mismatch.Login, &mismatch.Status, &mismatch.Accrual, &mismatch.Credited)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return mismatches, nil
+}
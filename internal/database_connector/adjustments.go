@@ -0,0 +1,73 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (pg *SQLBonusOps) RegisterBalanceAdjustment(adjustment storage.Adjustment) (int64, error) {
+	entry := storage.NewUserEntry(storage.BonusAdjustment, adjustment.Login, "", adjustment.Sum, adjustment.ProcessedAt)
+	entry.Reason = adjustment.Reason
+	entry.Note = adjustment.Note
+	entry.Actor = adjustment.Actor
+	err := makeTxContext(context.Background(), pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := lockedBalanceTx(ctx, tx, adjustment.Login)
+		if err != nil {
+			return err
+		}
+		if current+adjustment.Sum < 0 {
+			return storage.ErrInsufficientFunds
+		}
+		entry.ID, err = postLedgerEntryTx(ctx, tx, entry, pg.lotTTL)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, storage.ErrInsufficientFunds) {
+			pg.Logger.Error().Err(err).Msg("error when registering balance adjustment")
+		}
+		return 0, err
+	}
+	return entry.ID, nil
+}
+
+func (pg *SQLBonusOps) GetUserAdjustments(login string) ([]storage.Adjustment, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		`SELECT B.id,P.amount,B.reason,B.note,B.actor,B.placed_at,B.login
+		FROM BONUSES B JOIN POSTINGS P ON P.entry_id=B.id JOIN ACCOUNTS A ON A.id=P.account_id
+		WHERE A.code=$1 AND B.kind=$2 ORDER BY B.placed_at`,
+		storage.UserAccount(login), storage.BonusAdjustment,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query user adjustments from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	adjustments := []storage.Adjustment{}
+	for rows.Next() {
+		var adjustment storage.Adjustment
+		err = rows.Scan(
+			&adjustment.ID,
+			&adjustment.Sum,
+			&adjustment.Reason,
+			&adjustment.Note,
+			&adjustment.Actor,
+			&adjustment.ProcessedAt,
+			&adjustment.Login,
+		)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return adjustments, nil
+}
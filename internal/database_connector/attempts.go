@@ -0,0 +1,82 @@
+package dbconnector
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+type SQLAttemptOps struct {
+	Logger logger.Logger
+	DBConn *sql.DB
+}
+
+func (pg *SQLAttemptOps) GetLoginAttempts(subject string) (storage.LoginAttempts, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT failures,last_failure,blocked_until FROM LOGIN_ATTEMPTS WHERE subject=$1",
+		subject,
+	)
+	defer cancel()
+	attempts := storage.LoginAttempts{Subject: subject}
+	err := row.Scan(&attempts.Failures, &attempts.LastFailure, &attempts.BlockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return attempts, nil
+		}
+		pg.Logger.Error().Err(err).Msg("error when scanning login attempts row")
+		return attempts, err
+	}
+	return attempts, nil
+}
+
+func (pg *SQLAttemptOps) RegisterLoginFailure(subject string, failedAt time.Time, resetAfter time.Duration) (int64, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		`INSERT INTO LOGIN_ATTEMPTS (subject,failures,last_failure,blocked_until) VALUES ($1,1,$2,$2)
+		ON CONFLICT (subject) DO UPDATE SET
+		failures=CASE WHEN LOGIN_ATTEMPTS.last_failure<$3 THEN 1 ELSE LOGIN_ATTEMPTS.failures+1 END,
+		last_failure=$2
+		RETURNING failures`,
+		subject, failedAt, failedAt.Add(-resetAfter),
+	)
+	defer cancel()
+	var failures int64
+	err := row.Scan(&failures)
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when registering login failure")
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (pg *SQLAttemptOps) BlockLoginAttempts(subject string, until time.Time) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE LOGIN_ATTEMPTS SET blocked_until=$2 WHERE subject=$1",
+		subject, until,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLAttemptOps) ResetLoginAttempts(subject string) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM LOGIN_ATTEMPTS WHERE subject=$1",
+		subject,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/HellfastUSMC/gophermart/internal/logger"
@@ -26,6 +27,11 @@ type SQLConn struct {
 	SQLUserOps
 	SQLOrderOps
 	SQLBonusOps
+	SQLSessionOps
+	SQLAttemptOps
+	SQLResetOps
+	SQLIdempotencyOps
+	SQLAccrualJobOps
 }
 
 type SQLUserOps struct {
@@ -39,6 +45,7 @@ type SQLOrderOps struct {
 type SQLBonusOps struct {
 	Logger logger.Logger
 	DBConn *sql.DB
+	lotTTL time.Duration
 }
 
 func (pg *SQLConn) Close() error {
@@ -95,7 +102,13 @@ func makeExecContext(dbConn *sql.DB, logger logger.Logger, query string, args ..
 //}
 
 func (pg *SQLConn) GetUserWithdrawals(login string) ([]storage.Bonus, error) {
-	rows, cancel, err := makeQueryContext(pg.DBConn, "SELECT id,order_id,sum,placed_at,login FROM BONUSES WHERE login=$1 AND sub=true ORDER BY placed_at", login)
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		`SELECT W.id,W.order_id,W.sum,W.placed_at,W.login,R.placed_at
+		FROM BONUSES W LEFT JOIN BONUSES R ON R.reversal_of=W.id
+		WHERE W.login=$1 AND W.kind=$2 ORDER BY W.placed_at`,
+		login, storage.BonusWithdrawal,
+	)
 	if err != nil {
 		pg.Logger.Error().Err(err).Msg("error when query user withdraws from DB")
 		return nil, err
@@ -103,13 +116,19 @@ func (pg *SQLConn) GetUserWithdrawals(login string) ([]storage.Bonus, error) {
 	var (
 		withdrawals []storage.Bonus
 		withdraw    storage.Bonus
+		reversedAt  sql.NullTime
 	)
 	for rows.Next() {
-		err := rows.Scan(&withdraw.ID, &withdraw.OrderID, &withdraw.Sum, &withdraw.ProcessedAt, &withdraw.Login)
+		err := rows.Scan(&withdraw.ID, &withdraw.OrderID, &withdraw.Sum, &withdraw.ProcessedAt, &withdraw.Login, &reversedAt)
 		if err != nil {
 			pg.Logger.Error().Err(err).Msg("error when scanning rows")
 			return nil, err
 		}
+		withdraw.Status, withdraw.ReversedAt = storage.WithdrawalCompleted, ""
+		if reversedAt.Valid {
+			withdraw.Status = storage.WithdrawalReversed
+			withdraw.ReversedAt = reversedAt.Time.Format(time.RFC3339)
+		}
 		withdrawals = append(withdrawals, withdraw)
 	}
 	if rows.Err() != nil {
@@ -128,6 +147,27 @@ func (pg *SQLConn) GetUserWithdrawals(login string) ([]storage.Bonus, error) {
 	return withdrawals, nil
 }
 
+func makeTxContext(parent context.Context, dbConn *sql.DB, logger logger.Logger, txFunc func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(parent, time.Second*30)
+	defer cancel()
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("error when begin transaction")
+		return err
+	}
+	if err = txFunc(ctx, tx); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			logger.Error().Err(errRollback).Msg("error when rollback transaction")
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error().Err(err).Msg("error when commit transaction")
+		return err
+	}
+	return nil
+}
+
 func makeQueryRowCTX(dbConn *sql.DB, query string, args ...any) (*sql.Row, context.CancelFunc) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	row := dbConn.QueryRowContext(ctx, query, args...)
@@ -135,10 +175,13 @@ func makeQueryRowCTX(dbConn *sql.DB, query string, args ...any) (*sql.Row, conte
 }
 
 func (pg *SQLConn) GetOrder(order string) (storage.Order, error) {
-	row, cancel := makeQueryRowCTX(pg.DBConn, "SELECT * FROM ORDERS WHERE id=$1", order)
+	row, cancel := makeQueryRowCTX(pg.DBConn, "SELECT id,cashback,estimated_accrual,placed_at,login,status FROM ORDERS WHERE id=$1", order)
 	defer cancel()
 	var ord storage.Order
-	err := row.Scan(&ord.ID, &ord.Accrual, &ord.Date, &ord.Login, &ord.Status)
+	err := row.Scan(&ord.ID, &ord.Accrual, &ord.Estimate, &ord.Date, &ord.Login, &ord.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ord, storage.ErrOrderNotFound
+	}
 	if err != nil {
 		pg.Logger.Error().Err(err).Msg("error when scanning row")
 		return ord, err
@@ -146,8 +189,38 @@ func (pg *SQLConn) GetOrder(order string) (storage.Order, error) {
 	return ord, nil
 }
 
-func (pg *SQLOrderOps) GetUserOrders(login string) ([]storage.Order, error) {
-	rows, cancel, err := makeQueryContext(pg.DBConn, "SELECT * FROM ORDERS WHERE login=$1 ORDER BY placed_at", login)
+func (pg *SQLOrderOps) GetUserOrders(login string, filter storage.OrderFilter) ([]storage.Order, error) {
+	query := "SELECT id,cashback,estimated_accrual,placed_at,login,status FROM ORDERS WHERE login=$1"
+	args := []any{login}
+	arg := func(val any) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			placeholders = append(placeholders, arg(status))
+		}
+		query += " AND status IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	if !filter.From.IsZero() {
+		query += " AND placed_at>=" + arg(filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += " AND placed_at<" + arg(filter.To)
+	}
+	order, cmp := "ASC", ">"
+	if filter.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if filter.After != nil {
+		query += fmt.Sprintf(" AND (placed_at,id)%s(%s,%s)", cmp, arg(filter.After.At), arg(filter.After.ID))
+	}
+	query += fmt.Sprintf(" ORDER BY placed_at %s,id %s", order, order)
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	rows, cancel, err := makeQueryContext(pg.DBConn, query, args...)
 	if err != nil {
 		pg.Logger.Error().Err(err).Msg("error when searching user orders in DB")
 		return nil, err
@@ -155,15 +228,15 @@ func (pg *SQLOrderOps) GetUserOrders(login string) ([]storage.Order, error) {
 	defer cancel()
 	var (
 		orders []storage.Order
-		order  storage.Order
+		ord    storage.Order
 	)
 	for rows.Next() {
-		err := rows.Scan(&order.ID, &order.Accrual, &order.Date, &order.Login, &order.Status)
+		err := rows.Scan(&ord.ID, &ord.Accrual, &ord.Estimate, &ord.Date, &ord.Login, &ord.Status)
 		if err != nil {
 			pg.Logger.Error().Err(err).Msg("error in scanning rows")
 			return nil, err
 		}
-		orders = append(orders, order)
+		orders = append(orders, ord)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -251,47 +324,69 @@ func retryWriteFunc(
 	return nil
 }
 
-func (pg *SQLUserOps) CheckUserBalance(userLogin string) (float64, float64, error) {
-	current, cancel1 := makeQueryRowCTX(pg.DBConn, "SELECT cashback FROM USERS WHERE login=$1", userLogin)
-	defer cancel1()
-	withdrawn, cancel2 := makeQueryRowCTX(pg.DBConn, "SELECT SUM(SUM) FROM BONUSES WHERE login=$1 AND sub=true", userLogin)
-	defer cancel2()
-	var withdrawnDB sql.NullFloat64
-	var currentDB sql.NullFloat64
-	err := current.Scan(&currentDB)
+func (pg *SQLUserOps) CheckUserBalance(userLogin string) (storage.Money, storage.Money, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		`SELECT
+		(SELECT COALESCE(SUM(P.amount),0)::bigint FROM POSTINGS P JOIN ACCOUNTS A ON A.id=P.account_id WHERE A.code=$1),
+		(SELECT COALESCE(SUM(CASE WHEN kind=$3 THEN sum ELSE -sum END),0)::bigint FROM BONUSES WHERE login=$2 AND kind IN ($3,$4))`,
+		storage.UserAccount(userLogin), userLogin, storage.BonusWithdrawal, storage.BonusReversal,
+	)
+	defer cancel()
+	var current, withdrawn storage.Money
+	err := row.Scan(&current, &withdrawn)
 	if err != nil {
 		return 0, 0, err
 	}
-	err = withdrawn.Scan(&withdrawnDB)
+	return current, withdrawn, nil
+}
+
+func (pg *SQLUserOps) GetPendingBalance(userLogin string) (storage.Money, storage.Money, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		"SELECT cashback,estimated_accrual,status FROM ORDERS WHERE login=$1 AND status IN ('NEW','REGISTERED','PROCESSING')",
+		userLogin,
+	)
+	defer cancel()
 	if err != nil {
 		return 0, 0, err
 	}
-	return currentDB.Float64, withdrawnDB.Float64, nil
-}
-
-func (pg *SQLUserOps) UpdateUserBalance(checkUserBalance func(string) (float64, float64, error), userLogin string, sum float64, sub bool) (int64, error) {
-	if sub {
-		current, _, err := checkUserBalance(userLogin)
-		if err != nil {
-			return 0, err
-		}
-		if current < sum {
-			return 0, fmt.Errorf("can't substract from balance, current=%f < order=%f", current, sum)
-		}
-		rows, cancel, err := makeExecContext(pg.DBConn, pg.Logger, "UPDATE USERS SET cashback=cashback-$1 WHERE login=$2",
-			sum, userLogin,
-		)
-		defer cancel()
-		if err != nil {
-			return 0, err
+	var orders []storage.Order
+	for rows.Next() {
+		var ord storage.Order
+		if err = rows.Scan(&ord.Accrual, &ord.Estimate, &ord.Status); err != nil {
+			rows.Close()
+			return 0, 0, err
 		}
-		return rows, nil
+		orders = append(orders, ord)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, err
 	}
+	if err = rows.Close(); err != nil {
+		return 0, 0, err
+	}
+	row, cancelRow := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT COALESCE(SUM(sum),0)::bigint FROM HOLDS WHERE login=$1 AND status=$2",
+		userLogin, storage.HoldHeld,
+	)
+	defer cancelRow()
+	var held storage.Money
+	if err = row.Scan(&held); err != nil {
+		return 0, 0, err
+	}
+	return storage.PendingAccrual(orders), held, nil
+}
+
+func (pg *SQLOrderOps) RegisterOrder(orderID string, accrual storage.Money, placedAt string, login string) (int64, error) {
 	rows, cancel, err := makeExecContext(
 		pg.DBConn,
 		pg.Logger,
-		"UPDATE USERS SET cashback=cashback+$1 WHERE login=$2",
-		sum, userLogin,
+		"WITH O AS (INSERT INTO ORDERS (id,cashback,placed_at,login,status) VALUES ($1,$2,$3,$4,$5) RETURNING id,placed_at) "+
+			"INSERT INTO ACCRUAL_JOBS (order_id,next_attempt_at,created_at) SELECT id,placed_at,placed_at FROM O",
+		orderID, accrual, placedAt, login, "NEW",
 	)
 	defer cancel()
 	if err != nil {
@@ -300,12 +395,12 @@ func (pg *SQLUserOps) UpdateUserBalance(checkUserBalance func(string) (float64,
 	return rows, nil
 }
 
-func (pg *SQLOrderOps) RegisterOrder(orderID string, accrual float64, placedAt string, login string) (int64, error) {
+func (pg *SQLOrderOps) SetOrderEstimate(orderID string, estimate storage.Money) (int64, error) {
 	rows, cancel, err := makeExecContext(
 		pg.DBConn,
 		pg.Logger,
-		"INSERT INTO ORDERS (id,cashback,placed_at,login,status) VALUES ($1,$2,$3,$4,$5)",
-		orderID, accrual, placedAt, login, "NEW",
+		"UPDATE ORDERS SET estimated_accrual=$2 WHERE id=$1 AND status NOT IN ('PROCESSED','INVALID')",
+		orderID, estimate,
 	)
 	defer cancel()
 	if err != nil {
@@ -314,12 +409,16 @@ func (pg *SQLOrderOps) RegisterOrder(orderID string, accrual float64, placedAt s
 	return rows, nil
 }
 
-func (pg *SQLOrderOps) UpdateOrder(orderID string, accrual float64, status string) (int64, error) {
+func (pg *SQLUserOps) RegisterUser(login string, password string) (int64, error) {
+	hashedPass, err := storage.PasswordHasher(password)
+	if err != nil {
+		return 0, err
+	}
 	rows, cancel, err := makeExecContext(
 		pg.DBConn,
 		pg.Logger,
-		"UPDATE ORDERS SET cashback=$1, status=$3 WHERE id=$2",
-		accrual, orderID, status,
+		"INSERT INTO USERS (login,password) VALUES ($1,$2)",
+		login, string(hashedPass),
 	)
 	defer cancel()
 	if err != nil {
@@ -328,21 +427,22 @@ func (pg *SQLOrderOps) UpdateOrder(orderID string, accrual float64, status strin
 	return rows, nil
 }
 
-func (pg *SQLBonusOps) RegisterBonusChange(orderID string, sum float64, placedAt string, login string, sub bool) (int64, error) {
-	rows, cancel, err := makeExecContext(
+func (pg *SQLUserOps) UserExists(login string) (bool, error) {
+	row, cancel := makeQueryRowCTX(
 		pg.DBConn,
-		pg.Logger,
-		"INSERT INTO BONUSES (order_id, sum ,placed_at, login, sub) VALUES ($1,$2,$3,$4,$5)",
-		orderID, sum, placedAt, login, sub,
+		"SELECT EXISTS(SELECT 1 FROM USERS WHERE login=$1)",
+		login,
 	)
 	defer cancel()
+	var exists bool
+	err := row.Scan(&exists)
 	if err != nil {
-		return 0, err
+		return false, err
 	}
-	return rows, nil
+	return exists, nil
 }
 
-func (pg *SQLUserOps) RegisterUser(login string, password string) (int64, error) {
+func (pg *SQLUserOps) UpdateUserPassword(login string, password string) (int64, error) {
 	hashedPass, err := storage.PasswordHasher(password)
 	if err != nil {
 		return 0, err
@@ -350,8 +450,8 @@ func (pg *SQLUserOps) RegisterUser(login string, password string) (int64, error)
 	rows, cancel, err := makeExecContext(
 		pg.DBConn,
 		pg.Logger,
-		"INSERT INTO USERS (login,password,cashback) VALUES ($1,$2,$3)",
-		login, string(hashedPass), 0,
+		"UPDATE USERS SET password=$1 WHERE login=$2",
+		string(hashedPass), login,
 	)
 	defer cancel()
 	if err != nil {
@@ -360,52 +460,110 @@ func (pg *SQLUserOps) RegisterUser(login string, password string) (int64, error)
 	return rows, nil
 }
 
-func (pg *SQLUserOps) CheckUserCreds(login string, plainPassword string) (bool, error) {
+func (pg *SQLUserOps) GetUser(login string) (storage.User, error) {
 	row, cancel := makeQueryRowCTX(
 		pg.DBConn,
-		"SELECT password FROM USERS WHERE LOGIN=$1",
+		"SELECT login,role,blocked FROM USERS WHERE login=$1",
 		login,
 	)
 	defer cancel()
-	var userHashedPwd string
-	err := row.Scan(&userHashedPwd)
+	var user storage.User
+	err := row.Scan(&user.Login, &user.Role, &user.Blocked)
 	if err != nil {
-		return false, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, storage.ErrUserNotFound
+		}
+		return user, err
 	}
+	return user, nil
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(userHashedPwd), []byte(plainPassword))
+func (pg *SQLUserOps) SetUserRole(login string, role storage.Role) (int64, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE USERS SET role=$1 WHERE login=$2",
+		string(role), login,
+	)
+	defer cancel()
 	if err != nil {
-		pg.Logger.Error().Err(err).Msg("error compare passwords")
-		return false, err
+		return 0, err
 	}
-	return true, nil
+	return rows, nil
 }
 
-func (pg *SQLOrderOps) GetOrdersToCheck() ([]storage.Order, error) {
-	rows, cancel, err := makeQueryContext(
+func (pg *SQLUserOps) SetUserBlocked(login string, blocked bool) (int64, error) {
+	rows, cancel, err := makeExecContext(
 		pg.DBConn,
-		"SELECT * FROM orders WHERE status!='INVALID' AND status!='PROCESSED'",
+		pg.Logger,
+		"UPDATE USERS SET blocked=$1 WHERE login=$2",
+		blocked, login,
 	)
 	defer cancel()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if err := rows.Err(); err != nil {
+	return rows, nil
+}
+
+func (pg *SQLUserOps) SearchUsers(query string, limit int64, offset int64) ([]storage.User, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		"SELECT login,role,blocked FROM USERS WHERE login ILIKE $1 ORDER BY login LIMIT $2 OFFSET $3",
+		pattern, limit, offset,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when searching users in DB")
 		return nil, err
 	}
-	var orders []storage.Order
+	defer rows.Close()
+	users := []storage.User{}
 	for rows.Next() {
-		var order storage.Order
-		err = rows.Scan(&order.ID, &order.Accrual, &order.Date, &order.Login, &order.Status)
+		var user storage.User
+		err = rows.Scan(&user.Login, &user.Role, &user.Blocked)
 		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
 			return nil, err
 		}
-		orders = append(orders, order)
+		users = append(users, user)
 	}
-	return orders, nil
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return users, nil
 }
 
-func NewConnectionSQL(connPath string, logger logger.Logger) (*SQLConn, error) {
+func (pg *SQLUserOps) CheckUserCreds(login string, plainPassword string) (bool, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT password FROM USERS WHERE LOGIN=$1",
+		login,
+	)
+	defer cancel()
+	var userHashedPwd string
+	err := row.Scan(&userHashedPwd)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(userHashedPwd), []byte(plainPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		pg.Logger.Error().Err(err).Msg("error compare passwords")
+		return false, err
+	}
+	return true, nil
+}
+
+func NewConnectionSQL(connPath string, logger logger.Logger, lotTTL time.Duration) (*SQLConn, error) {
 	db, err := sql.Open("pgx", connPath)
 	if err != nil {
 		return nil, err
@@ -428,6 +586,27 @@ func NewConnectionSQL(connPath string, logger logger.Logger) (*SQLConn, error) {
 	bonus := SQLBonusOps{
 		DBConn: db,
 		Logger: logger,
+		lotTTL: lotTTL,
+	}
+	session := SQLSessionOps{
+		DBConn: db,
+		Logger: logger,
+	}
+	attempt := SQLAttemptOps{
+		DBConn: db,
+		Logger: logger,
+	}
+	reset := SQLResetOps{
+		DBConn: db,
+		Logger: logger,
+	}
+	idempotency := SQLIdempotencyOps{
+		DBConn: db,
+		Logger: logger,
+	}
+	accrualJob := SQLAccrualJobOps{
+		DBConn: db,
+		Logger: logger,
 	}
 	return &SQLConn{
 		connPath,
@@ -436,5 +615,10 @@ func NewConnectionSQL(connPath string, logger logger.Logger) (*SQLConn, error) {
 		user,
 		order,
 		bonus,
+		session,
+		attempt,
+		reset,
+		idempotency,
+		accrualJob,
 	}, nil
 }
@@ -0,0 +1,90 @@
+package dbconnector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (pg *SQLBonusOps) GetUserHistory(login string, filter storage.HistoryFilter) ([]storage.HistoryEntry, error) {
+	args := []any{storage.UserAccount(login), login}
+	arg := func(val any) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	var conds []string
+	if len(filter.Kinds) > 0 {
+		placeholders := make([]string, 0, len(filter.Kinds))
+		for _, kind := range filter.Kinds {
+			placeholders = append(placeholders, arg(kind))
+		}
+		conds = append(conds, "kind IN ("+strings.Join(placeholders, ",")+")")
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "placed_at>="+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "placed_at<"+arg(filter.To))
+	}
+	order, cmp := "ASC", ">"
+	if filter.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if filter.After != nil {
+		afterID, err := strconv.ParseInt(filter.After.ID, 10, 64)
+		if err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		conds = append(conds, fmt.Sprintf("(placed_at,id)%s(%s,%s)", cmp, arg(filter.After.At), arg(afterID)))
+	}
+	query := `WITH HISTORY AS (
+		SELECT B.id,B.kind,COALESCE(B.order_id,'') AS order_id,COALESCE(P.amount,0) AS amount,
+		SUM(COALESCE(P.amount,0)) OVER (ORDER BY B.placed_at,B.id)::bigint AS balance,
+		CASE WHEN P.amount IS NULL THEN B.sum ELSE 0 END::bigint AS captured,
+		B.reason,B.note,B.placed_at
+		FROM BONUSES B LEFT JOIN POSTINGS P ON P.entry_id=B.id AND P.account_id=(SELECT id FROM ACCOUNTS WHERE code=$1)
+		WHERE B.login=$2
+	)
+	SELECT id,kind,order_id,amount,balance,captured,reason,note,placed_at FROM HISTORY`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY placed_at %s,id %s", order, order)
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	rows, cancel, err := makeQueryContext(pg.DBConn, query, args...)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query user history from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	var history []storage.HistoryEntry
+	for rows.Next() {
+		var entry storage.HistoryEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.Kind,
+			&entry.OrderID,
+			&entry.Amount,
+			&entry.Balance,
+			&entry.Captured,
+			&entry.Reason,
+			&entry.Note,
+			&entry.ProcessedAt,
+		)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,137 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (pg *SQLBonusOps) HoldPoints(ctx context.Context, hold storage.Hold) (storage.Hold, error) {
+	hold.Status = storage.HoldHeld
+	entry := storage.NewUserEntry(storage.BonusHold, hold.Login, hold.OrderID, -hold.Sum, hold.CreatedAt.Format(time.RFC3339))
+	err := makeTxContext(ctx, pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := lockedBalanceTx(ctx, tx, hold.Login)
+		if err != nil {
+			return err
+		}
+		if current < hold.Sum {
+			return storage.ErrInsufficientFunds
+		}
+		entryID, err := postLedgerEntryTx(ctx, tx, entry, pg.lotTTL)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(
+			ctx,
+			"INSERT INTO HOLDS (login,order_id,sum,status,entry_id,created_at,expires_at) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id",
+			hold.Login, hold.OrderID, hold.Sum, hold.Status, entryID, hold.CreatedAt, hold.ExpiresAt,
+		).Scan(&hold.ID)
+	})
+	if err != nil && !errors.Is(err, storage.ErrInsufficientFunds) {
+		pg.Logger.Error().Err(err).Msg("error when holding points")
+	}
+	return hold, err
+}
+
+func (pg *SQLBonusOps) CaptureHold(ctx context.Context, id int64) (storage.Hold, error) {
+	return pg.settleHold(ctx, id, storage.HoldCaptured)
+}
+
+func (pg *SQLBonusOps) ReleaseHold(ctx context.Context, id int64) (storage.Hold, error) {
+	return pg.settleHold(ctx, id, storage.HoldReleased)
+}
+
+func (pg *SQLBonusOps) ReleaseExpiredHolds(now time.Time) (int64, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		"SELECT id FROM HOLDS WHERE status=$1 AND expires_at<=$2 ORDER BY expires_at",
+		storage.HoldHeld, now,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query expired holds from DB")
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error when closing rows")
+		return 0, err
+	}
+	var released int64
+	for _, id := range ids {
+		_, err = pg.settleHold(context.Background(), id, storage.HoldReleased)
+		if errors.Is(err, storage.ErrHoldSettled) {
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+func (pg *SQLBonusOps) settleHold(ctx context.Context, id int64, status string) (storage.Hold, error) {
+	hold := storage.Hold{ID: id}
+	err := makeTxContext(ctx, pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		var entryID int64
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT login,order_id,sum,status,entry_id,created_at,expires_at FROM HOLDS WHERE id=$1 FOR UPDATE",
+			id,
+		).Scan(&hold.Login, &hold.OrderID, &hold.Sum, &hold.Status, &entryID, &hold.CreatedAt, &hold.ExpiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrHoldNotFound
+			}
+			return err
+		}
+		if hold.Status != storage.HoldHeld {
+			return storage.ErrHoldSettled
+		}
+		now := time.Now()
+		entry := storage.NewCaptureEntry(hold.Login, hold.OrderID, hold.Sum, now.Format(time.RFC3339))
+		if status == storage.HoldReleased {
+			entry = storage.NewUserEntry(storage.BonusRelease, hold.Login, hold.OrderID, hold.Sum, now.Format(time.RFC3339))
+			entry.ReversalOf = entryID
+		}
+		settledID, err := postLedgerEntryTx(ctx, tx, entry, pg.lotTTL)
+		if err != nil {
+			return err
+		}
+		if status == storage.HoldCaptured {
+			_, err = tx.ExecContext(ctx, "UPDATE LOT_CONSUMPTIONS SET entry_id=$2 WHERE entry_id=$1", entryID, settledID)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE HOLDS SET status=$2,settled_at=$3 WHERE id=$1", id, status, now)
+		if err != nil {
+			return err
+		}
+		hold.Status = status
+		hold.SettledAt = &now
+		return nil
+	})
+	if err != nil && !errors.Is(err, storage.ErrHoldNotFound) && !errors.Is(err, storage.ErrHoldSettled) {
+		pg.Logger.Error().Err(err).Msg("error when settling hold")
+	}
+	return hold, err
+}
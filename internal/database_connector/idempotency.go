@@ -0,0 +1,98 @@
+package dbconnector
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+type SQLIdempotencyOps struct {
+	Logger logger.Logger
+	DBConn *sql.DB
+}
+
+func (pg *SQLIdempotencyOps) ReserveIdempotencyKey(record storage.IdempotencyRecord) (storage.IdempotencyRecord, bool, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"INSERT INTO IDEMPOTENCY_KEYS (key,login,request_hash,created_at,locked_until) VALUES ($1,$2,$3,$4,$5) ON CONFLICT (login,key) DO NOTHING",
+		record.Key, record.Login, record.RequestHash, record.Created, record.LockedUntil,
+	)
+	defer cancel()
+	if err != nil {
+		return record, false, err
+	}
+	if rows == 1 {
+		return record, true, nil
+	}
+	rows, cancelTakeover, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE IDEMPOTENCY_KEYS SET locked_until=$4 WHERE login=$1 AND key=$2 AND request_hash=$3 AND status=0 AND locked_until<$5",
+		record.Login, record.Key, record.RequestHash, record.LockedUntil, record.Created,
+	)
+	defer cancelTakeover()
+	if err != nil {
+		return record, false, err
+	}
+	if rows == 1 {
+		return record, true, nil
+	}
+	row, cancelRow := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT request_hash,status,content_type,body,created_at,locked_until FROM IDEMPOTENCY_KEYS WHERE login=$1 AND key=$2",
+		record.Login, record.Key,
+	)
+	defer cancelRow()
+	stored := storage.IdempotencyRecord{Key: record.Key, Login: record.Login}
+	err = row.Scan(&stored.RequestHash, &stored.Status, &stored.ContentType, &stored.Body, &stored.Created, &stored.LockedUntil)
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when scanning idempotency key row")
+		return stored, false, err
+	}
+	return stored, false, nil
+}
+
+func (pg *SQLIdempotencyOps) CompleteIdempotencyKey(record storage.IdempotencyRecord) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE IDEMPOTENCY_KEYS SET status=$3,content_type=$4,body=$5 WHERE login=$1 AND key=$2",
+		record.Login, record.Key, record.Status, record.ContentType, record.Body,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLIdempotencyOps) ReleaseIdempotencyKey(login string, key string) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM IDEMPOTENCY_KEYS WHERE login=$1 AND key=$2 AND status=0",
+		login, key,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLIdempotencyOps) ExpireIdempotencyKeys(createdBefore time.Time) (int64, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM IDEMPOTENCY_KEYS WHERE created_at<$1",
+		createdBefore,
+	)
+	defer cancel()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
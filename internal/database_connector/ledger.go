@@ -0,0 +1,181 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const pgUniqueViolation = "23505"
+
+func (pg *SQLBonusOps) Withdraw(ctx context.Context, login string, order string, sum storage.Money, dailyLimit storage.Money) error {
+	now := time.Now()
+	entry := storage.NewUserEntry(storage.BonusWithdrawal, login, order, -sum, now.Format(time.RFC3339))
+	err := makeTxContext(ctx, pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := lockedBalanceTx(ctx, tx, login)
+		if err != nil {
+			return err
+		}
+		if current < sum {
+			return storage.ErrInsufficientFunds
+		}
+		if dailyLimit > 0 {
+			var withdrawnToday storage.Money
+			err = tx.QueryRowContext(
+				ctx,
+				"SELECT COALESCE(SUM(sum),0)::bigint FROM BONUSES WHERE login=$1 AND kind=$2 AND placed_at>$3",
+				login, storage.BonusWithdrawal, now.Add(-24*time.Hour),
+			).Scan(&withdrawnToday)
+			if err != nil {
+				return err
+			}
+			if withdrawnToday+sum > dailyLimit {
+				return storage.ErrDailyLimitExceeded
+			}
+		}
+		_, err = postLedgerEntryTx(ctx, tx, entry, pg.lotTTL)
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return storage.ErrOrderAlreadyWithdrawn
+	}
+	if err != nil && !errors.Is(err, storage.ErrInsufficientFunds) && !errors.Is(err, storage.ErrDailyLimitExceeded) {
+		pg.Logger.Error().Err(err).Msg("error when withdrawing from balance")
+	}
+	return err
+}
+
+func (pg *SQLBonusOps) ReverseWithdrawal(ctx context.Context, reversal storage.Reversal) (storage.Bonus, error) {
+	withdrawal := storage.Bonus{OrderID: reversal.OrderID}
+	err := makeTxContext(ctx, pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT id,sum,placed_at,login FROM BONUSES WHERE order_id=$1 AND kind=$2 FOR UPDATE",
+			reversal.OrderID, storage.BonusWithdrawal,
+		).Scan(&withdrawal.ID, &withdrawal.Sum, &withdrawal.ProcessedAt, &withdrawal.Login)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrWithdrawalNotFound
+			}
+			return err
+		}
+		var reversed bool
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT EXISTS(SELECT 1 FROM BONUSES WHERE reversal_of=$1)",
+			withdrawal.ID,
+		).Scan(&reversed)
+		if err != nil {
+			return err
+		}
+		if reversed {
+			return storage.ErrAlreadyReversed
+		}
+		entry := storage.NewUserEntry(storage.BonusReversal, withdrawal.Login, reversal.OrderID, withdrawal.Sum, reversal.ProcessedAt)
+		entry.Reason = reversal.Reason
+		entry.Note = reversal.Note
+		entry.Actor = reversal.Actor
+		entry.ReversalOf = withdrawal.ID
+		_, err = postLedgerEntryTx(ctx, tx, entry, pg.lotTTL)
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		err = storage.ErrAlreadyReversed
+	}
+	if err != nil {
+		if !errors.Is(err, storage.ErrWithdrawalNotFound) && !errors.Is(err, storage.ErrAlreadyReversed) {
+			pg.Logger.Error().Err(err).Msg("error when reversing withdrawal")
+		}
+		return withdrawal, err
+	}
+	withdrawal.Status = storage.WithdrawalReversed
+	withdrawal.ReversedAt = reversal.ProcessedAt
+	return withdrawal, nil
+}
+
+func lockedBalanceTx(ctx context.Context, tx *sql.Tx, login string) (storage.Money, error) {
+	accountID, err := accountIDTx(ctx, tx, storage.UserAccount(login), login)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT id FROM ACCOUNTS WHERE id=$1 FOR UPDATE", accountID)
+	if err != nil {
+		return 0, err
+	}
+	var current storage.Money
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(SUM(amount),0)::bigint FROM POSTINGS WHERE account_id=$1",
+		accountID,
+	).Scan(&current)
+	if err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func postLedgerEntryTx(ctx context.Context, tx *sql.Tx, entry storage.LedgerEntry, lotTTL time.Duration) (int64, error) {
+	var total storage.Money
+	for _, posting := range entry.Postings {
+		total += posting.Amount
+	}
+	if len(entry.Postings) < 2 || total != 0 {
+		return 0, storage.ErrUnbalancedEntry
+	}
+	orderID := sql.NullString{String: entry.OrderID, Valid: entry.OrderID != ""}
+	reversalOf := sql.NullInt64{Int64: entry.ReversalOf, Valid: entry.ReversalOf != 0}
+	var entryID int64
+	err := tx.QueryRowContext(
+		ctx,
+		"INSERT INTO BONUSES (order_id,sum,placed_at,login,kind,reason,note,actor,reversal_of) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id",
+		orderID, entry.Sum, entry.PlacedAt, entry.Login, entry.Kind, entry.Reason, entry.Note, entry.Actor, reversalOf,
+	).Scan(&entryID)
+	if err != nil {
+		return 0, err
+	}
+	for _, posting := range entry.Postings {
+		accountID, err := accountIDTx(ctx, tx, posting.Account, posting.Login)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO POSTINGS (entry_id,account_id,amount) VALUES ($1,$2,$3)",
+			entryID, accountID, posting.Amount,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = applyLotsTx(ctx, tx, entry, entryID, lotTTL); err != nil {
+		return 0, err
+	}
+	return entryID, nil
+}
+
+func accountIDTx(ctx context.Context, tx *sql.Tx, code string, login string) (int64, error) {
+	var accountID int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM ACCOUNTS WHERE code=$1", code).Scan(&accountID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return accountID, err
+	}
+	accountLogin := sql.NullString{String: login, Valid: login != ""}
+	err = tx.QueryRowContext(
+		ctx,
+		"INSERT INTO ACCOUNTS (code,login) VALUES ($1,$2) ON CONFLICT (code) DO NOTHING RETURNING id",
+		code, accountLogin,
+	).Scan(&accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRowContext(ctx, "SELECT id FROM ACCOUNTS WHERE code=$1", code).Scan(&accountID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
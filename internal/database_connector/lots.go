@@ -0,0 +1,258 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+const expireLotsBatch = 500
+
+type lotBalance struct {
+	ID        int64
+	Login     string
+	Remaining storage.Money
+}
+
+func applyLotsTx(ctx context.Context, tx *sql.Tx, entry storage.LedgerEntry, entryID int64, lotTTL time.Duration) error {
+	if entry.Kind == storage.BonusExpiration {
+		return nil
+	}
+	now := time.Now()
+	for _, posting := range entry.Postings {
+		if posting.Login == "" || posting.Amount == 0 {
+			continue
+		}
+		if posting.Amount < 0 {
+			if err := consumeLotsTx(ctx, tx, entryID, posting.Login, -posting.Amount); err != nil {
+				return err
+			}
+			continue
+		}
+		amount := posting.Amount
+		if entry.ReversalOf != 0 {
+			restored, err := restoreLotsTx(ctx, tx, entry.ReversalOf, amount)
+			if err != nil {
+				return err
+			}
+			amount -= restored
+			if amount == 0 {
+				continue
+			}
+		}
+		expiresAt := sql.NullTime{}
+		if entry.Kind == storage.BonusAccrual && lotTTL > 0 {
+			expiresAt = sql.NullTime{Time: now.Add(lotTTL), Valid: true}
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO LOTS (login,entry_id,amount,remaining,created_at,expires_at) VALUES ($1,$2,$3,$3,$4,$5)",
+			posting.Login, entryID, amount, now, expiresAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func consumeLotsTx(ctx context.Context, tx *sql.Tx, entryID int64, login string, sum storage.Money) error {
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id,remaining FROM LOTS WHERE login=$1 AND remaining>0 ORDER BY created_at,id FOR UPDATE",
+		login,
+	)
+	if err != nil {
+		return err
+	}
+	var lots []lotBalance
+	for rows.Next() {
+		lot := lotBalance{Login: login}
+		if err = rows.Scan(&lot.ID, &lot.Remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, lot)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		if sum == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > sum {
+			take = sum
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE LOTS SET remaining=remaining-$2 WHERE id=$1", lot.ID, take)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO LOT_CONSUMPTIONS (entry_id,lot_id,amount) VALUES ($1,$2,$3)",
+			entryID, lot.ID, take,
+		)
+		if err != nil {
+			return err
+		}
+		sum -= take
+	}
+	return nil
+}
+
+func restoreLotsTx(ctx context.Context, tx *sql.Tx, consumedBy int64, sum storage.Money) (storage.Money, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT C.lot_id,C.amount FROM LOT_CONSUMPTIONS C JOIN LOTS L ON L.id=C.lot_id
+		WHERE C.entry_id=$1 AND C.amount>0 ORDER BY L.created_at,L.id FOR UPDATE OF C`,
+		consumedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var consumed []lotBalance
+	for rows.Next() {
+		var lot lotBalance
+		if err = rows.Scan(&lot.ID, &lot.Remaining); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		consumed = append(consumed, lot)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+	var restored storage.Money
+	for _, lot := range consumed {
+		if restored == sum {
+			break
+		}
+		give := lot.Remaining
+		if give > sum-restored {
+			give = sum - restored
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE LOTS SET remaining=remaining+$2 WHERE id=$1", lot.ID, give)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE LOT_CONSUMPTIONS SET amount=amount-$3 WHERE entry_id=$1 AND lot_id=$2",
+			consumedBy, lot.ID, give,
+		)
+		if err != nil {
+			return 0, err
+		}
+		restored += give
+	}
+	return restored, nil
+}
+
+func (pg *SQLBonusOps) GetUpcomingExpirations(login string, before time.Time) ([]storage.Expiration, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		`SELECT remaining,expires_at FROM LOTS
+		WHERE login=$1 AND remaining>0 AND expires_at IS NOT NULL AND expires_at<=$2 ORDER BY expires_at`,
+		login, before,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query upcoming expirations from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	var expirations []storage.Expiration
+	for rows.Next() {
+		var expiration storage.Expiration
+		if err = rows.Scan(&expiration.Sum, &expiration.ExpiresAt); err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		expirations = append(expirations, expiration)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return expirations, nil
+}
+
+func (pg *SQLBonusOps) ExpireLots(now time.Time) (int64, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		"SELECT id,login,remaining FROM LOTS WHERE remaining>0 AND expires_at<=$1 ORDER BY expires_at LIMIT $2",
+		now, expireLotsBatch,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query expired lots from DB")
+		return 0, err
+	}
+	var lots []lotBalance
+	for rows.Next() {
+		var lot lotBalance
+		if err = rows.Scan(&lot.ID, &lot.Login, &lot.Remaining); err != nil {
+			rows.Close()
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return 0, err
+		}
+		lots = append(lots, lot)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error when closing rows")
+		return 0, err
+	}
+	var expired int64
+	for _, lot := range lots {
+		posted := false
+		err = makeTxContext(context.Background(), pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+			accountID, err := accountIDTx(ctx, tx, storage.UserAccount(lot.Login), lot.Login)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "SELECT id FROM ACCOUNTS WHERE id=$1 FOR UPDATE", accountID)
+			if err != nil {
+				return err
+			}
+			var remaining storage.Money
+			err = tx.QueryRowContext(ctx, "SELECT remaining FROM LOTS WHERE id=$1 FOR UPDATE", lot.ID).Scan(&remaining)
+			if err != nil || remaining <= 0 {
+				return err
+			}
+			entry := storage.NewUserEntry(storage.BonusExpiration, lot.Login, "", -remaining, now.Format(time.RFC3339))
+			entry.Reason = "points_expired"
+			entry.Actor = "system"
+			if _, err = postLedgerEntryTx(ctx, tx, entry, pg.lotTTL); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE LOTS SET remaining=0 WHERE id=$1", lot.ID)
+			posted = err == nil
+			return err
+		})
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when expiring lot")
+			return expired, err
+		}
+		if posted {
+			expired++
+		}
+	}
+	return expired, nil
+}
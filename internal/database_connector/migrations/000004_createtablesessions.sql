@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS SESSIONS (
+            TOKEN_HASH varchar NOT NULL UNIQUE PRIMARY KEY,
+            LOGIN varchar NOT NULL,
+            CREATED_AT timestamptz NOT NULL
+        );
+CREATE INDEX IF NOT EXISTS SESSIONS_LOGIN_IDX ON SESSIONS (LOGIN);
+
+-- +goose Down
+DROP TABLE SESSIONS;
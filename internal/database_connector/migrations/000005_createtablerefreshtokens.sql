@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS REFRESH_TOKENS (
+            TOKEN_HASH varchar NOT NULL UNIQUE PRIMARY KEY,
+            FAMILY varchar NOT NULL,
+            LOGIN varchar NOT NULL,
+            CREATED_AT timestamptz NOT NULL,
+            EXPIRES_AT timestamptz NOT NULL,
+            USED bool NOT NULL DEFAULT false
+        );
+CREATE INDEX IF NOT EXISTS REFRESH_TOKENS_FAMILY_IDX ON REFRESH_TOKENS (FAMILY);
+
+-- +goose Down
+DROP TABLE REFRESH_TOKENS;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE SESSIONS ADD COLUMN IF NOT EXISTS ID varchar;
+UPDATE SESSIONS SET ID=md5(random()::text || TOKEN_HASH) WHERE ID IS NULL;
+ALTER TABLE SESSIONS DROP CONSTRAINT IF EXISTS SESSIONS_PKEY;
+ALTER TABLE SESSIONS ALTER COLUMN TOKEN_HASH DROP NOT NULL;
+ALTER TABLE SESSIONS ALTER COLUMN ID SET NOT NULL;
+ALTER TABLE SESSIONS ADD PRIMARY KEY (ID);
+ALTER TABLE SESSIONS ADD COLUMN IF NOT EXISTS USER_AGENT varchar NOT NULL DEFAULT '';
+ALTER TABLE SESSIONS ADD COLUMN IF NOT EXISTS IP varchar NOT NULL DEFAULT '';
+ALTER TABLE SESSIONS ADD COLUMN IF NOT EXISTS LAST_SEEN timestamptz NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE SESSIONS DROP COLUMN LAST_SEEN;
+ALTER TABLE SESSIONS DROP COLUMN IP;
+ALTER TABLE SESSIONS DROP COLUMN USER_AGENT;
+ALTER TABLE SESSIONS DROP CONSTRAINT IF EXISTS SESSIONS_PKEY;
+DELETE FROM SESSIONS WHERE TOKEN_HASH IS NULL;
+ALTER TABLE SESSIONS ALTER COLUMN TOKEN_HASH SET NOT NULL;
+ALTER TABLE SESSIONS ADD PRIMARY KEY (TOKEN_HASH);
+ALTER TABLE SESSIONS DROP COLUMN ID;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS LOGIN_ATTEMPTS (
+            SUBJECT varchar NOT NULL UNIQUE PRIMARY KEY,
+            FAILURES integer NOT NULL,
+            LAST_FAILURE timestamptz NOT NULL,
+            BLOCKED_UNTIL timestamptz NOT NULL
+        );
+
+-- +goose Down
+DROP TABLE LOGIN_ATTEMPTS;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS PASSWORD_RESETS (
+            TOKEN_HASH varchar NOT NULL UNIQUE PRIMARY KEY,
+            LOGIN varchar NOT NULL,
+            CREATED_AT timestamptz NOT NULL,
+            EXPIRES_AT timestamptz NOT NULL,
+            USED_AT timestamptz
+        );
+
+-- +goose Down
+DROP TABLE PASSWORD_RESETS;
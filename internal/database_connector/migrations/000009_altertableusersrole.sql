@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE USERS ADD COLUMN IF NOT EXISTS ROLE varchar NOT NULL DEFAULT 'user';
+ALTER TABLE USERS ADD CONSTRAINT USERS_ROLE_CHECK CHECK (ROLE IN ('user', 'support', 'admin'));
+
+-- +goose Down
+ALTER TABLE USERS DROP CONSTRAINT IF EXISTS USERS_ROLE_CHECK;
+ALTER TABLE USERS DROP COLUMN ROLE;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE USERS ADD COLUMN IF NOT EXISTS BLOCKED bool NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE USERS DROP COLUMN BLOCKED;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE BONUSES ADD COLUMN IF NOT EXISTS KIND varchar;
+UPDATE BONUSES SET KIND = CASE WHEN SUB THEN 'withdrawal' ELSE 'accrual' END WHERE KIND IS NULL;
+ALTER TABLE BONUSES ALTER COLUMN KIND SET NOT NULL;
+ALTER TABLE BONUSES ALTER COLUMN ORDER_ID DROP NOT NULL;
+ALTER TABLE BONUSES ADD COLUMN IF NOT EXISTS REASON varchar NOT NULL DEFAULT '';
+ALTER TABLE BONUSES ADD COLUMN IF NOT EXISTS NOTE text NOT NULL DEFAULT '';
+ALTER TABLE BONUSES ADD COLUMN IF NOT EXISTS ACTOR varchar NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS BONUSES_LOGIN_KIND_IDX ON BONUSES (LOGIN, KIND);
+
+-- +goose Down
+DROP INDEX IF EXISTS BONUSES_LOGIN_KIND_IDX;
+DELETE FROM BONUSES WHERE KIND='adjustment';
+ALTER TABLE BONUSES DROP COLUMN ACTOR;
+ALTER TABLE BONUSES DROP COLUMN NOTE;
+ALTER TABLE BONUSES DROP COLUMN REASON;
+ALTER TABLE BONUSES ALTER COLUMN ORDER_ID SET NOT NULL;
+ALTER TABLE BONUSES DROP COLUMN KIND;
@@ -0,0 +1,73 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS ACCOUNTS (
+            ID serial NOT NULL UNIQUE PRIMARY KEY,
+            CODE varchar NOT NULL UNIQUE,
+            LOGIN varchar
+        );
+CREATE TABLE IF NOT EXISTS POSTINGS (
+            ID serial NOT NULL UNIQUE PRIMARY KEY,
+            ENTRY_ID integer NOT NULL REFERENCES BONUSES (ID),
+            ACCOUNT_ID integer NOT NULL REFERENCES ACCOUNTS (ID),
+            AMOUNT double precision NOT NULL
+        );
+CREATE INDEX IF NOT EXISTS POSTINGS_ACCOUNT_IDX ON POSTINGS (ACCOUNT_ID);
+CREATE INDEX IF NOT EXISTS POSTINGS_ENTRY_IDX ON POSTINGS (ENTRY_ID);
+
+INSERT INTO ACCOUNTS (CODE) VALUES
+    ('system:accruals'),
+    ('system:withdrawals'),
+    ('system:adjustments'),
+    ('system:opening')
+ON CONFLICT (CODE) DO NOTHING;
+INSERT INTO ACCOUNTS (CODE, LOGIN)
+SELECT 'user:' || LOGIN, LOGIN FROM (SELECT LOGIN FROM USERS UNION SELECT LOGIN FROM BONUSES) AS LOGINS
+ON CONFLICT (CODE) DO NOTHING;
+
+INSERT INTO POSTINGS (ENTRY_ID, ACCOUNT_ID, AMOUNT)
+SELECT B.ID, A.ID, CASE WHEN B.SUB THEN -B.SUM ELSE B.SUM END
+FROM BONUSES B JOIN ACCOUNTS A ON A.CODE = 'user:' || B.LOGIN;
+INSERT INTO POSTINGS (ENTRY_ID, ACCOUNT_ID, AMOUNT)
+SELECT B.ID, A.ID, CASE WHEN B.SUB THEN B.SUM ELSE -B.SUM END
+FROM BONUSES B JOIN ACCOUNTS A ON A.CODE = CASE B.KIND
+    WHEN 'accrual' THEN 'system:accruals'
+    WHEN 'withdrawal' THEN 'system:withdrawals'
+    ELSE 'system:adjustments' END;
+
+-- +goose StatementBegin
+WITH DIFFS AS (
+    SELECT U.LOGIN, U.CASHBACK - COALESCE((
+        SELECT SUM(P.AMOUNT) FROM POSTINGS P JOIN ACCOUNTS A ON A.ID = P.ACCOUNT_ID
+        WHERE A.CODE = 'user:' || U.LOGIN
+    ), 0) AS DIFF
+    FROM USERS U
+), ENTRIES AS (
+    INSERT INTO BONUSES (ORDER_ID, SUM, PLACED_AT, LOGIN, SUB, KIND, REASON, NOTE, ACTOR)
+    SELECT NULL, ABS(DIFF), to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), LOGIN, DIFF < 0,
+        'adjustment', 'ledger_backfill', 'opening balance carried over from USERS.CASHBACK', 'system'
+    FROM DIFFS WHERE DIFF <> 0
+    RETURNING ID, LOGIN, SUM, SUB
+), USER_LEGS AS (
+    INSERT INTO POSTINGS (ENTRY_ID, ACCOUNT_ID, AMOUNT)
+    SELECT E.ID, A.ID, CASE WHEN E.SUB THEN -E.SUM ELSE E.SUM END
+    FROM ENTRIES E JOIN ACCOUNTS A ON A.CODE = 'user:' || E.LOGIN
+)
+INSERT INTO POSTINGS (ENTRY_ID, ACCOUNT_ID, AMOUNT)
+SELECT E.ID, A.ID, CASE WHEN E.SUB THEN E.SUM ELSE -E.SUM END
+FROM ENTRIES E JOIN ACCOUNTS A ON A.CODE = 'system:opening';
+-- +goose StatementEnd
+
+ALTER TABLE USERS DROP COLUMN CASHBACK;
+ALTER TABLE BONUSES DROP COLUMN SUB;
+
+-- +goose Down
+ALTER TABLE BONUSES ADD COLUMN SUB bool NOT NULL DEFAULT false;
+UPDATE BONUSES B SET SUB = P.AMOUNT < 0
+FROM POSTINGS P JOIN ACCOUNTS A ON A.ID = P.ACCOUNT_ID
+WHERE P.ENTRY_ID = B.ID AND A.LOGIN IS NOT NULL;
+ALTER TABLE USERS ADD COLUMN CASHBACK double precision NOT NULL DEFAULT 0;
+UPDATE USERS U SET CASHBACK = COALESCE((
+    SELECT SUM(P.AMOUNT) FROM POSTINGS P JOIN ACCOUNTS A ON A.ID = P.ACCOUNT_ID
+    WHERE A.CODE = 'user:' || U.LOGIN
+), 0);
+DROP TABLE POSTINGS;
+DROP TABLE ACCOUNTS;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE ORDERS ALTER COLUMN CASHBACK TYPE bigint USING ROUND(CASHBACK::numeric * 100)::bigint;
+ALTER TABLE BONUSES ALTER COLUMN SUM TYPE bigint USING ROUND(SUM::numeric * 100)::bigint;
+ALTER TABLE POSTINGS ALTER COLUMN AMOUNT TYPE bigint USING ROUND(AMOUNT::numeric * 100)::bigint;
+
+-- +goose Down
+ALTER TABLE POSTINGS ALTER COLUMN AMOUNT TYPE double precision USING AMOUNT / 100.0;
+ALTER TABLE BONUSES ALTER COLUMN SUM TYPE double precision USING SUM / 100.0;
+ALTER TABLE ORDERS ALTER COLUMN CASHBACK TYPE double precision USING CASHBACK / 100.0;
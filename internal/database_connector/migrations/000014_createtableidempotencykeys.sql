@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS IDEMPOTENCY_KEYS (
+            KEY varchar NOT NULL,
+            LOGIN varchar NOT NULL,
+            REQUEST_HASH varchar NOT NULL,
+            STATUS integer NOT NULL DEFAULT 0,
+            CONTENT_TYPE varchar NOT NULL DEFAULT '',
+            BODY bytea,
+            CREATED_AT timestamptz NOT NULL,
+            PRIMARY KEY (LOGIN, KEY)
+        );
+CREATE INDEX IF NOT EXISTS IDEMPOTENCY_KEYS_CREATED_AT_IDX ON IDEMPOTENCY_KEYS (CREATED_AT);
+
+-- +goose Down
+DROP TABLE IDEMPOTENCY_KEYS;
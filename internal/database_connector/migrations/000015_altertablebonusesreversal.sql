@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE BONUSES DROP CONSTRAINT IF EXISTS BONUSES_ORDER_ID_KEY;
+CREATE UNIQUE INDEX IF NOT EXISTS BONUSES_ORDER_KIND_IDX ON BONUSES (ORDER_ID, KIND);
+ALTER TABLE BONUSES ADD COLUMN IF NOT EXISTS REVERSAL_OF integer UNIQUE REFERENCES BONUSES (ID);
+
+-- +goose Down
+DELETE FROM POSTINGS WHERE ENTRY_ID IN (SELECT ID FROM BONUSES WHERE KIND='reversal');
+DELETE FROM BONUSES WHERE KIND='reversal';
+ALTER TABLE BONUSES DROP COLUMN REVERSAL_OF;
+DROP INDEX IF EXISTS BONUSES_ORDER_KIND_IDX;
+ALTER TABLE BONUSES ADD CONSTRAINT BONUSES_ORDER_ID_KEY UNIQUE (ORDER_ID);
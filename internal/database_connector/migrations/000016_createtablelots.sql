@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS LOTS (
+            ID serial NOT NULL UNIQUE PRIMARY KEY,
+            LOGIN varchar NOT NULL,
+            ENTRY_ID integer REFERENCES BONUSES (ID),
+            AMOUNT bigint NOT NULL,
+            REMAINING bigint NOT NULL,
+            CREATED_AT timestamptz NOT NULL,
+            EXPIRES_AT timestamptz
+        );
+CREATE INDEX IF NOT EXISTS LOTS_LOGIN_IDX ON LOTS (LOGIN, CREATED_AT) WHERE REMAINING > 0;
+CREATE INDEX IF NOT EXISTS LOTS_EXPIRES_AT_IDX ON LOTS (EXPIRES_AT) WHERE REMAINING > 0;
+
+INSERT INTO ACCOUNTS (CODE) VALUES ('system:expirations') ON CONFLICT (CODE) DO NOTHING;
+
+INSERT INTO LOTS (LOGIN, ENTRY_ID, AMOUNT, REMAINING, CREATED_AT, EXPIRES_AT)
+SELECT A.LOGIN, NULL, SUM(P.AMOUNT), SUM(P.AMOUNT), now(), NULL
+FROM POSTINGS P JOIN ACCOUNTS A ON A.ID = P.ACCOUNT_ID
+WHERE A.LOGIN IS NOT NULL
+GROUP BY A.LOGIN
+HAVING SUM(P.AMOUNT) > 0;
+
+-- +goose Down
+DROP TABLE LOTS;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS HOLDS (
+            ID serial NOT NULL UNIQUE PRIMARY KEY,
+            LOGIN varchar NOT NULL,
+            ORDER_ID varchar NOT NULL UNIQUE,
+            SUM bigint NOT NULL,
+            STATUS varchar NOT NULL,
+            ENTRY_ID integer NOT NULL REFERENCES BONUSES (ID),
+            CREATED_AT timestamptz NOT NULL,
+            EXPIRES_AT timestamptz NOT NULL,
+            SETTLED_AT timestamptz
+        );
+CREATE INDEX IF NOT EXISTS HOLDS_LOGIN_IDX ON HOLDS (LOGIN) WHERE STATUS = 'HELD';
+CREATE INDEX IF NOT EXISTS HOLDS_EXPIRES_AT_IDX ON HOLDS (EXPIRES_AT) WHERE STATUS = 'HELD';
+CREATE INDEX IF NOT EXISTS ORDERS_LOGIN_STATUS_IDX ON ORDERS (LOGIN, STATUS);
+
+INSERT INTO ACCOUNTS (CODE) VALUES ('system:holds') ON CONFLICT (CODE) DO NOTHING;
+
+-- +goose Down
+DROP INDEX IF EXISTS ORDERS_LOGIN_STATUS_IDX;
+DROP TABLE HOLDS;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE ORDERS ALTER COLUMN PLACED_AT TYPE timestamptz USING PLACED_AT::timestamptz;
+CREATE INDEX IF NOT EXISTS ORDERS_LOGIN_PLACED_AT_IDX ON ORDERS (LOGIN, PLACED_AT, ID);
+
+-- +goose Down
+DROP INDEX IF EXISTS ORDERS_LOGIN_PLACED_AT_IDX;
+ALTER TABLE ORDERS ALTER COLUMN PLACED_AT TYPE text USING to_char(PLACED_AT AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"');
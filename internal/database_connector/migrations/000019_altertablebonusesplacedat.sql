@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE BONUSES ALTER COLUMN PLACED_AT TYPE timestamptz USING PLACED_AT::timestamptz;
+CREATE INDEX IF NOT EXISTS BONUSES_LOGIN_PLACED_AT_IDX ON BONUSES (LOGIN, PLACED_AT, ID);
+
+-- +goose Down
+DROP INDEX IF EXISTS BONUSES_LOGIN_PLACED_AT_IDX;
+ALTER TABLE BONUSES ALTER COLUMN PLACED_AT TYPE text USING to_char(PLACED_AT AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"');
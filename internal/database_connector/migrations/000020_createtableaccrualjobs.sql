@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS ACCRUAL_JOBS (
+            ORDER_ID varchar NOT NULL UNIQUE PRIMARY KEY REFERENCES ORDERS (ID),
+            ATTEMPTS integer NOT NULL DEFAULT 0,
+            NEXT_ATTEMPT_AT timestamptz NOT NULL,
+            LAST_ERROR varchar NOT NULL DEFAULT '',
+            CREATED_AT timestamptz NOT NULL,
+            DEAD_AT timestamptz
+        );
+CREATE INDEX IF NOT EXISTS ACCRUAL_JOBS_NEXT_ATTEMPT_AT_IDX ON ACCRUAL_JOBS (NEXT_ATTEMPT_AT) WHERE DEAD_AT IS NULL;
+CREATE INDEX IF NOT EXISTS ACCRUAL_JOBS_DEAD_AT_IDX ON ACCRUAL_JOBS (DEAD_AT) WHERE DEAD_AT IS NOT NULL;
+
+INSERT INTO ACCRUAL_JOBS (ORDER_ID, NEXT_ATTEMPT_AT, CREATED_AT)
+SELECT ID, now(), now() FROM ORDERS WHERE STATUS NOT IN ('INVALID', 'PROCESSED')
+ON CONFLICT (ORDER_ID) DO NOTHING;
+
+-- +goose Down
+DROP TABLE ACCRUAL_JOBS;
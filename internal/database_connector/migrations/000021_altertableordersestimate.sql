@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE ORDERS ADD COLUMN IF NOT EXISTS ESTIMATED_ACCRUAL bigint NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE ORDERS DROP COLUMN IF EXISTS ESTIMATED_ACCRUAL;
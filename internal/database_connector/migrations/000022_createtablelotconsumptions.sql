@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS LOT_CONSUMPTIONS (
+            ENTRY_ID integer NOT NULL REFERENCES BONUSES (ID),
+            LOT_ID integer NOT NULL REFERENCES LOTS (ID),
+            AMOUNT bigint NOT NULL,
+            PRIMARY KEY (ENTRY_ID, LOT_ID)
+        );
+
+-- +goose Down
+DROP TABLE LOT_CONSUMPTIONS;
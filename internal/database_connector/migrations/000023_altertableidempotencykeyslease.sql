@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE IDEMPOTENCY_KEYS ADD COLUMN IF NOT EXISTS LOCKED_UNTIL timestamptz;
+UPDATE IDEMPOTENCY_KEYS SET LOCKED_UNTIL = CREATED_AT WHERE LOCKED_UNTIL IS NULL;
+ALTER TABLE IDEMPOTENCY_KEYS ALTER COLUMN LOCKED_UNTIL SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE IDEMPOTENCY_KEYS DROP COLUMN IF EXISTS LOCKED_UNTIL;
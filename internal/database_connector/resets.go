@@ -0,0 +1,94 @@
+package dbconnector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+type SQLResetOps struct {
+	Logger logger.Logger
+	DBConn *sql.DB
+}
+
+func (pg *SQLResetOps) IssuePasswordReset(reset storage.PasswordReset) error {
+	err := makeTxContext(context.Background(), pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE PASSWORD_RESETS SET used_at=$2 WHERE login=$1 AND used_at IS NULL",
+			reset.Login, reset.Created,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO PASSWORD_RESETS (token_hash,login,created_at,expires_at) VALUES ($1,$2,$3,$4)",
+			storage.TokenHasher(reset.Token), reset.Login, reset.Created, reset.ExpiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when issuing password reset token")
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLResetOps) GetPasswordReset(token string, at time.Time) (storage.PasswordReset, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT login,created_at,expires_at FROM PASSWORD_RESETS WHERE token_hash=$1 AND used_at IS NULL AND expires_at>$2",
+		storage.TokenHasher(token), at,
+	)
+	defer cancel()
+	reset := storage.PasswordReset{Token: token}
+	err := row.Scan(&reset.Login, &reset.Created, &reset.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return reset, storage.ErrResetTokenInvalid
+		}
+		pg.Logger.Error().Err(err).Msg("error when searching password reset token")
+		return reset, err
+	}
+	return reset, nil
+}
+
+func (pg *SQLResetOps) UsePasswordReset(token string, usedAt time.Time, password string) (storage.PasswordReset, error) {
+	reset := storage.PasswordReset{Token: token}
+	hashedPass, err := storage.PasswordHasher(password)
+	if err != nil {
+		return reset, err
+	}
+	err = makeTxContext(context.Background(), pg.DBConn, pg.Logger, func(ctx context.Context, tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			"UPDATE PASSWORD_RESETS SET used_at=$2 WHERE token_hash=$1 AND used_at IS NULL AND expires_at>$2 RETURNING login,created_at,expires_at",
+			storage.TokenHasher(token), usedAt,
+		).Scan(&reset.Login, &reset.Created, &reset.ExpiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrResetTokenInvalid
+			}
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE PASSWORD_RESETS SET used_at=$2 WHERE login=$1 AND used_at IS NULL",
+			reset.Login, usedAt,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE USERS SET password=$1 WHERE login=$2", string(hashedPass), reset.Login)
+		return err
+	})
+	if err != nil && !errors.Is(err, storage.ErrResetTokenInvalid) {
+		pg.Logger.Error().Err(err).Msg("error when using password reset token")
+	}
+	return reset, err
+}
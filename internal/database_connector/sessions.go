@@ -0,0 +1,260 @@
+package dbconnector
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+type SQLSessionOps struct {
+	Logger logger.Logger
+	DBConn *sql.DB
+}
+
+const sessionColumns = "id,login,created_at,last_seen,user_agent,ip"
+
+func scanSession(row interface{ Scan(dest ...any) error }, session *storage.Token) error {
+	return row.Scan(&session.ID, &session.User, &session.Created, &session.LastSeen, &session.UserAgent, &session.IP)
+}
+
+func (pg *SQLSessionOps) IssueSession(token storage.Token) error {
+	tokenHash := sql.NullString{}
+	if token.Token != "" {
+		tokenHash = sql.NullString{String: storage.TokenHasher(token.Token), Valid: true}
+	}
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"INSERT INTO SESSIONS (id,token_hash,login,created_at,last_seen,user_agent,ip) VALUES ($1,$2,$3,$4,$5,$6,$7)",
+		token.ID, tokenHash, token.User, token.Created, token.LastSeen, token.UserAgent, token.IP,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLSessionOps) LookupSession(token string) (storage.Token, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT "+sessionColumns+" FROM SESSIONS WHERE token_hash=$1",
+		storage.TokenHasher(token),
+	)
+	defer cancel()
+	session := storage.Token{Token: token}
+	err := scanSession(row, &session)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, storage.ErrSessionNotFound
+		}
+		pg.Logger.Error().Err(err).Msg("error when scanning session row")
+		return session, err
+	}
+	return session, nil
+}
+
+func (pg *SQLSessionOps) LookupSessionByID(id string) (storage.Token, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT "+sessionColumns+" FROM SESSIONS WHERE id=$1",
+		id,
+	)
+	defer cancel()
+	var session storage.Token
+	err := scanSession(row, &session)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, storage.ErrSessionNotFound
+		}
+		pg.Logger.Error().Err(err).Msg("error when scanning session row")
+		return session, err
+	}
+	return session, nil
+}
+
+func (pg *SQLSessionOps) TouchSession(id string, lastSeen time.Time) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"UPDATE SESSIONS SET last_seen=$2 WHERE id=$1 AND last_seen<$2 - interval '1 minute'",
+		id, lastSeen,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLSessionOps) RevokeSession(login string, id string) error {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM SESSIONS WHERE id=$1 AND login=$2",
+		id, login,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return storage.ErrSessionNotFound
+	}
+	return pg.RevokeRefreshFamily(id)
+}
+
+func (pg *SQLSessionOps) RevokeUserSessions(login string, exceptID string) (int64, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM SESSIONS WHERE login=$1 AND id!=$2",
+		login, exceptID,
+	)
+	defer cancel()
+	if err != nil {
+		return 0, err
+	}
+	_, cancelRefresh, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM REFRESH_TOKENS WHERE login=$1 AND family!=$2",
+		login, exceptID,
+	)
+	defer cancelRefresh()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (pg *SQLSessionOps) GetUserSessions(login string) ([]storage.Token, error) {
+	rows, cancel, err := makeQueryContext(
+		pg.DBConn,
+		"SELECT "+sessionColumns+" FROM SESSIONS WHERE login=$1 ORDER BY created_at",
+		login,
+	)
+	defer cancel()
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query user sessions from DB")
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []storage.Token
+	for rows.Next() {
+		var session storage.Token
+		err = scanSession(rows, &session)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (pg *SQLSessionOps) ExpireSessions(lastSeenBefore time.Time) (int64, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM SESSIONS WHERE last_seen<$1",
+		lastSeenBefore,
+	)
+	defer cancel()
+	if err != nil {
+		return 0, err
+	}
+	_, cancelRefresh, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM REFRESH_TOKENS WHERE family NOT IN (SELECT id FROM SESSIONS)",
+	)
+	defer cancelRefresh()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (pg *SQLSessionOps) IssueRefreshToken(token storage.RefreshToken) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"INSERT INTO REFRESH_TOKENS (token_hash,family,login,created_at,expires_at,used) VALUES ($1,$2,$3,$4,$5,$6)",
+		storage.TokenHasher(token.Token), token.Family, token.User, token.Created, token.ExpiresAt, token.Used,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLSessionOps) UseRefreshToken(token string) (storage.RefreshToken, error) {
+	refresh := storage.RefreshToken{Token: token}
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		"UPDATE REFRESH_TOKENS SET used=true WHERE token_hash=$1 AND used=false RETURNING family,login,created_at,expires_at",
+		storage.TokenHasher(token),
+	)
+	defer cancel()
+	err := row.Scan(&refresh.Family, &refresh.User, &refresh.Created, &refresh.ExpiresAt)
+	if err == nil {
+		refresh.Used = true
+		return refresh, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		pg.Logger.Error().Err(err).Msg("error when using refresh token")
+		return refresh, err
+	}
+	row, cancelUsed := makeQueryRowCTX(
+		pg.DBConn,
+		"SELECT family,login,created_at,expires_at,used FROM REFRESH_TOKENS WHERE token_hash=$1",
+		storage.TokenHasher(token),
+	)
+	defer cancelUsed()
+	err = row.Scan(&refresh.Family, &refresh.User, &refresh.Created, &refresh.ExpiresAt, &refresh.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return refresh, storage.ErrRefreshTokenNotFound
+		}
+		pg.Logger.Error().Err(err).Msg("error when scanning refresh token row")
+		return refresh, err
+	}
+	return refresh, storage.ErrRefreshTokenReused
+}
+
+func (pg *SQLSessionOps) RevokeRefreshFamily(family string) error {
+	_, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM REFRESH_TOKENS WHERE family=$1",
+		family,
+	)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *SQLSessionOps) ExpireRefreshTokens(expiredBefore time.Time) (int64, error) {
+	rows, cancel, err := makeExecContext(
+		pg.DBConn,
+		pg.Logger,
+		"DELETE FROM REFRESH_TOKENS WHERE expires_at<$1",
+		expiredBefore,
+	)
+	defer cancel()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,61 @@
+package dbconnector
+
+import (
+	"context"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func (pg *SQLBonusOps) GetBalanceAt(login string, at time.Time) (storage.Money, error) {
+	row, cancel := makeQueryRowCTX(
+		pg.DBConn,
+		`SELECT COALESCE(SUM(P.amount),0)::bigint
+		FROM POSTINGS P JOIN ACCOUNTS A ON A.id=P.account_id JOIN BONUSES B ON B.id=P.entry_id
+		WHERE A.code=$1 AND B.placed_at<$2`,
+		storage.UserAccount(login), at,
+	)
+	defer cancel()
+	var balance storage.Money
+	if err := row.Scan(&balance); err != nil {
+		pg.Logger.Error().Err(err).Msg("error when scanning balance row")
+		return 0, err
+	}
+	return balance, nil
+}
+
+func (pg *SQLBonusOps) StreamUserStatement(ctx context.Context, login string, from time.Time, to time.Time, fn func(row storage.StatementRow) error) error {
+	rows, err := pg.DBConn.QueryContext(
+		ctx,
+		`SELECT record,placed_at,type,order_id,status,accrual,amount FROM (
+			SELECT $3::text AS record,O.placed_at,$3::text AS type,O.id AS order_id,O.status,O.cashback AS accrual,0::bigint AS amount,0 AS seq
+			FROM ORDERS O WHERE O.login=$2 AND O.placed_at>=$5 AND O.placed_at<$6
+			UNION ALL
+			SELECT $4::text,B.placed_at,B.kind,COALESCE(B.order_id,''),'',0::bigint,COALESCE(P.amount,0),B.id
+			FROM BONUSES B LEFT JOIN POSTINGS P ON P.entry_id=B.id AND P.account_id=(SELECT id FROM ACCOUNTS WHERE code=$1)
+			WHERE B.login=$2 AND B.placed_at>=$5 AND B.placed_at<$6
+		) AS STATEMENT ORDER BY placed_at,seq`,
+		storage.UserAccount(login), login, storage.StatementOrder, storage.StatementEntry, from, to,
+	)
+	if err != nil {
+		pg.Logger.Error().Err(err).Msg("error when query user statement from DB")
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row storage.StatementRow
+		err = rows.Scan(&row.Record, &row.Date, &row.Type, &row.OrderID, &row.Status, &row.Accrual, &row.Amount)
+		if err != nil {
+			pg.Logger.Error().Err(err).Msg("error when scanning rows")
+			return err
+		}
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		pg.Logger.Error().Err(err).Msg("error in rows")
+		return err
+	}
+	return nil
+}
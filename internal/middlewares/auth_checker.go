@@ -1,37 +1,79 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
+	"github.com/HellfastUSMC/gophermart/internal/auth_tokens"
 	"github.com/HellfastUSMC/gophermart/internal/logger"
 	"github.com/HellfastUSMC/gophermart/internal/storage"
 )
 
-func CheckAuth(log logger.Logger, tokens map[string]storage.Token) func(h http.Handler) http.Handler {
+func CheckAuth(log logger.Logger, sessions storage.SessionStore, signer authtokens.Signer, users storage.UserOps) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			credentials := req.Header.Get("Authorization")
-			if strings.Contains(req.URL.String(), "register") || strings.Contains(req.URL.String(), "login") {
-				h.ServeHTTP(res, req)
+			if credentials == "" {
+				log.Error().Err(fmt.Errorf("auth error")).Msg(fmt.Sprintf("Somebody tried to open %s with wrong credentials", req.URL.String()))
+				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
 				return
 			}
-			if credentials != "" {
-				for _, val := range tokens {
-					if val.Token == credentials {
-						h.ServeHTTP(res, req)
-						return
-					}
+			session, err := resolveSession(credentials, sessions, signer)
+			if err != nil {
+				if !errors.Is(err, storage.ErrSessionNotFound) {
+					log.Error().Err(err).Msg("cannot lookup session")
+					http.Error(res, "cannot lookup session", http.StatusInternalServerError)
+					return
 				}
 				log.Error().Err(fmt.Errorf("auth error")).Msg(fmt.Sprintf("Somebody tried to open %s with wrong credentials", req.URL.String()))
 				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
 				return
-			} else {
-				log.Error().Err(fmt.Errorf("auth error")).Msg(fmt.Sprintf("Somebody tried to open %s with wrong credentials", req.URL.String()))
-				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
+			}
+			user, err := users.GetUser(session.User)
+			if err != nil {
+				if errors.Is(err, storage.ErrUserNotFound) {
+					log.Error().Err(err).Msg(fmt.Sprintf("Session %s belongs to missing user %s", session.ID, session.User))
+					http.Error(res, "Credentials are missing", http.StatusUnauthorized)
+					return
+				}
+				log.Error().Err(err).Msg("cannot get session user")
+				http.Error(res, "cannot get session user", http.StatusInternalServerError)
+				return
+			}
+			if user.Blocked {
+				log.Error().Msg(fmt.Sprintf("Blocked user %s tried to open %s", user.Login, req.URL.String()))
+				http.Error(res, "Account is blocked", http.StatusForbidden)
 				return
 			}
+			if err = sessions.TouchSession(session.ID, time.Now()); err != nil {
+				log.Error().Err(err).Msg("cannot update session last seen time")
+			}
+			principal := Principal{
+				Login:     user.Login,
+				SessionID: session.ID,
+				Role:      user.Role,
+			}
+			h.ServeHTTP(res, req.WithContext(withUser(req.Context(), principal)))
 		})
 	}
 }
+
+func resolveSession(credentials string, sessions storage.SessionStore, signer authtokens.Signer) (storage.Token, error) {
+	if signer == nil {
+		return sessions.LookupSession(credentials)
+	}
+	claims, err := signer.Verify(credentials)
+	if err != nil {
+		return storage.Token{}, storage.ErrSessionNotFound
+	}
+	session, err := sessions.LookupSessionByID(claims.SessionID)
+	if err != nil {
+		return session, err
+	}
+	if session.User != claims.Subject {
+		return storage.Token{}, storage.ErrSessionNotFound
+	}
+	return session, nil
+}
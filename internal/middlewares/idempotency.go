@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+const idempotencyLease = time.Minute
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func requestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func Idempotency(log logger.Logger, keys storage.IdempotencyOps) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				h.ServeHTTP(res, req)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				log.Error().Msg(fmt.Sprintf("idempotency key of %d bytes is too long", len(key)))
+				http.Error(res, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+			user, ok := UserFromContext(req.Context())
+			if !ok {
+				log.Error().Msg(fmt.Sprintf("Somebody tried to open %s without credentials", req.URL.String()))
+				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
+				return
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				log.Error().Err(err).Msg("cannot read request body")
+				http.Error(res, "cannot read request body", http.StatusInternalServerError)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewBuffer(body))
+			hash := requestHash(req, body)
+			now := time.Now()
+			record, reserved, err := keys.ReserveIdempotencyKey(storage.IdempotencyRecord{
+				Key:         key,
+				Login:       user.Login,
+				RequestHash: hash,
+				Created:     now,
+				LockedUntil: now.Add(idempotencyLease),
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("cannot reserve idempotency key")
+				http.Error(res, "cannot reserve idempotency key", http.StatusInternalServerError)
+				return
+			}
+			if !reserved {
+				if record.RequestHash != hash {
+					log.Error().Msg(fmt.Sprintf("user %s reused idempotency key %s with different request", user.Login, key))
+					http.Error(res, "idempotency key was already used with different request", http.StatusUnprocessableEntity)
+					return
+				}
+				if record.Status == 0 {
+					log.Error().Msg(fmt.Sprintf("request of user %s with idempotency key %s is still in progress", user.Login, key))
+					http.Error(res, "request with this idempotency key is in progress", http.StatusConflict)
+					return
+				}
+				log.Info().Msg(fmt.Sprintf("replaying response for user %s with idempotency key %s", user.Login, key))
+				if record.ContentType != "" {
+					res.Header().Add("Content-Type", record.ContentType)
+				}
+				res.Header().Add("Idempotent-Replayed", "true")
+				res.Header().Add("Date", time.Now().Format(http.TimeFormat))
+				res.WriteHeader(record.Status)
+				if _, err = res.Write(record.Body); err != nil {
+					log.Error().Err(err).Msg("error in writing response")
+				}
+				return
+			}
+			settled := false
+			defer func() {
+				if settled {
+					return
+				}
+				if err := keys.ReleaseIdempotencyKey(user.Login, key); err != nil {
+					log.Error().Err(err).Msg("cannot release idempotency key")
+				}
+			}()
+			recorder := &responseRecorder{ResponseWriter: res}
+			h.ServeHTTP(recorder, req)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			settled = true
+			record.Status = recorder.status
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.Body = recorder.body.Bytes()
+			if err = keys.CompleteIdempotencyKey(record); err != nil {
+				log.Error().Err(err).Msg("cannot store idempotent response")
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/rs/zerolog"
+)
+
+type memoryKeys struct {
+	mu      sync.Mutex
+	records map[string]storage.IdempotencyRecord
+}
+
+func newMemoryKeys() *memoryKeys {
+	return &memoryKeys{records: map[string]storage.IdempotencyRecord{}}
+}
+
+func (m *memoryKeys) ReserveIdempotencyKey(record storage.IdempotencyRecord) (storage.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.records[record.Login+"/"+record.Key]
+	if !ok || stored.Status == 0 && stored.RequestHash == record.RequestHash && stored.LockedUntil.Before(record.Created) {
+		m.records[record.Login+"/"+record.Key] = record
+		return record, true, nil
+	}
+	return stored, false, nil
+}
+
+func (m *memoryKeys) CompleteIdempotencyKey(record storage.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.Login+"/"+record.Key] = record
+	return nil
+}
+
+func (m *memoryKeys) ReleaseIdempotencyKey(login string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.records[login+"/"+key].Status == 0 {
+		delete(m.records, login+"/"+key)
+	}
+	return nil
+}
+
+func (m *memoryKeys) ExpireIdempotencyKeys(createdBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryKeys) held(login string, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.records[login+"/"+key]
+	return ok
+}
+
+func serveIdempotent(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	req = req.WithContext(withUser(req.Context(), Principal{Login: "user"}))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestIdempotencyReplaysCompletedResponse(t *testing.T) {
+	keys := newMemoryKeys()
+	log := zerolog.Nop()
+	calls := 0
+	handler := Idempotency(&log, keys)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		res.WriteHeader(http.StatusCreated)
+		res.Write([]byte("done"))
+	}))
+	first := serveIdempotent(t, handler, `{"sum":1}`)
+	second := serveIdempotent(t, handler, `{"sum":1}`)
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != "done" || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, "done")
+	}
+	if mismatch := serveIdempotent(t, handler, `{"sum":2}`); mismatch.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reuse with different body = %d, want %d", mismatch.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	keys := newMemoryKeys()
+	log := zerolog.Nop()
+	handler := Idempotency(&log, keys)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was swallowed by middleware")
+			}
+		}()
+		serveIdempotent(t, handler, `{"sum":1}`)
+	}()
+	if keys.held("user", "key-1") {
+		t.Error("idempotency key is still reserved after handler panic")
+	}
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	keys := newMemoryKeys()
+	log := zerolog.Nop()
+	handler := Idempotency(&log, keys)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "failed", http.StatusInternalServerError)
+	}))
+	serveIdempotent(t, handler, `{"sum":1}`)
+	if keys.held("user", "key-1") {
+		t.Error("idempotency key is still reserved after server error")
+	}
+}
+
+func TestIdempotencyInProgressUntilLeaseExpires(t *testing.T) {
+	keys := newMemoryKeys()
+	log := zerolog.Nop()
+	handler := Idempotency(&log, keys)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	body := `{"sum":1}`
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(body))
+	abandoned := storage.IdempotencyRecord{
+		Key:         "key-1",
+		Login:       "user",
+		RequestHash: requestHash(req, []byte(body)),
+		Created:     time.Now(),
+		LockedUntil: time.Now().Add(idempotencyLease),
+	}
+	keys.records["user/key-1"] = abandoned
+	if res := serveIdempotent(t, handler, body); res.Code != http.StatusConflict {
+		t.Fatalf("request during lease = %d, want %d", res.Code, http.StatusConflict)
+	}
+	abandoned.LockedUntil = time.Now().Add(-time.Second)
+	keys.records["user/key-1"] = abandoned
+	if res := serveIdempotent(t, handler, body); res.Code != http.StatusOK {
+		t.Fatalf("request after lease = %d, want %d", res.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"context"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+type Principal struct {
+	Login     string
+	SessionID string
+	Role      storage.Role
+}
+
+type principalKey struct{}
+
+func withUser(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func UserFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+)
+
+func RequireRole(log logger.Logger, roles ...storage.Role) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			user, ok := UserFromContext(req.Context())
+			if !ok {
+				log.Error().Msg(fmt.Sprintf("Somebody tried to open %s without credentials", req.URL.String()))
+				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
+				return
+			}
+			for _, role := range roles {
+				if user.Role == role {
+					h.ServeHTTP(res, req)
+					return
+				}
+			}
+			log.Error().Msg(fmt.Sprintf("User %s with role %s tried to open %s", user.Login, user.Role, req.URL.String()))
+			http.Error(res, "Access denied", http.StatusForbidden)
+		})
+	}
+}
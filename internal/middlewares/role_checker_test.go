@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HellfastUSMC/gophermart/internal/storage"
+	"github.com/rs/zerolog"
+)
+
+func TestRequireRole(t *testing.T) {
+	log := zerolog.Nop()
+	handler := RequireRole(&log, storage.RoleSupport, storage.RoleAdmin)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"user", &Principal{Login: "gopher", Role: storage.RoleUser}, http.StatusForbidden},
+		{"empty role", &Principal{Login: "gopher"}, http.StatusForbidden},
+		{"support", &Principal{Login: "helper", Role: storage.RoleSupport}, http.StatusOK},
+		{"admin", &Principal{Login: "root", Role: storage.RoleAdmin}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+			if tt.principal != nil {
+				req = req.WithContext(withUser(req.Context(), *tt.principal))
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			if res.Code != tt.want {
+				t.Errorf("status = %d, want %d", res.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+)
+
+const ServiceLogin = "service"
+
+func CheckServiceToken(log logger.Logger, token string) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			credentials := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if token == "" || subtle.ConstantTimeCompare([]byte(credentials), []byte(token)) != 1 {
+				log.Error().Msg(fmt.Sprintf("Somebody tried to open %s with wrong service credentials", req.URL.String()))
+				http.Error(res, "Credentials are missing", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(res, req.WithContext(withUser(req.Context(), Principal{Login: ServiceLogin})))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HellfastUSMC/gophermart/internal/logger"
+)
+
+type Notifier interface {
+	NotifyPasswordReset(login string, token string, expiresAt time.Time) error
+}
+
+type LogNotifier struct {
+	Logger logger.Logger
+}
+
+func (n *LogNotifier) NotifyPasswordReset(login string, token string, expiresAt time.Time) error {
+	n.Logger.Info().Msg(fmt.Sprintf(
+		"password reset token for user %s is %s, valid until %s",
+		login,
+		token,
+		expiresAt.Format(time.RFC3339),
+	))
+	return nil
+}
+
+type FileNotifier struct {
+	mu   sync.Mutex
+	Path string
+}
+
+func (n *FileNotifier) NotifyPasswordReset(login string, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\n", login, token, expiresAt.Format(time.RFC3339))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func NewNotifier(kind string, path string, logger logger.Logger) (Notifier, error) {
+	switch kind {
+	case "log":
+		return &LogNotifier{Logger: logger}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("no file path provided for file notifier")
+		}
+		return &FileNotifier{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %s", kind)
+	}
+}
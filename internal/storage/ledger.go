@@ -0,0 +1,71 @@
+package storage
+
+const (
+	AccountAccruals    = "system:accruals"
+	AccountWithdrawals = "system:withdrawals"
+	AccountAdjustments = "system:adjustments"
+	AccountExpirations = "system:expirations"
+	AccountHolds       = "system:holds"
+)
+
+var counterAccounts = map[string]string{
+	BonusAccrual:    AccountAccruals,
+	BonusWithdrawal: AccountWithdrawals,
+	BonusAdjustment: AccountAdjustments,
+	BonusReversal:   AccountWithdrawals,
+	BonusExpiration: AccountExpirations,
+	BonusHold:       AccountHolds,
+	BonusRelease:    AccountHolds,
+}
+
+type Posting struct {
+	Account string
+	Login   string
+	Amount  Money
+}
+
+type LedgerEntry struct {
+	ID         int64
+	OrderID    string
+	Kind       string
+	Sum        Money
+	PlacedAt   string
+	Login      string
+	Reason     string
+	Note       string
+	Actor      string
+	ReversalOf int64
+	Postings   []Posting
+}
+
+func UserAccount(login string) string {
+	return "user:" + login
+}
+
+func NewUserEntry(kind string, login string, orderID string, delta Money, placedAt string) LedgerEntry {
+	return LedgerEntry{
+		OrderID:  orderID,
+		Kind:     kind,
+		Sum:      delta.Abs(),
+		PlacedAt: placedAt,
+		Login:    login,
+		Postings: []Posting{
+			{Account: UserAccount(login), Login: login, Amount: delta},
+			{Account: counterAccounts[kind], Amount: -delta},
+		},
+	}
+}
+
+func NewCaptureEntry(login string, orderID string, sum Money, placedAt string) LedgerEntry {
+	return LedgerEntry{
+		OrderID:  orderID,
+		Kind:     BonusWithdrawal,
+		Sum:      sum,
+		PlacedAt: placedAt,
+		Login:    login,
+		Postings: []Posting{
+			{Account: AccountHolds, Amount: -sum},
+			{Account: AccountWithdrawals, Amount: sum},
+		},
+	}
+}
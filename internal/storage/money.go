@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MoneyScale    = 100
+	MoneyDecimals = 2
+)
+
+var (
+	ErrMoneyPrecision = errors.New("money amount has too many decimal places")
+	ErrMoneyRange     = errors.New("money amount is out of range")
+	ErrMoneyFormat    = errors.New("money amount has wrong format")
+)
+
+var (
+	moneyPattern        = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+	roundedMoneyPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]{1,2})?$`)
+)
+
+type Money int64
+
+func ParseMoney(raw string) (Money, error) {
+	raw = strings.TrimSpace(raw)
+	if !moneyPattern.MatchString(raw) {
+		return 0, ErrMoneyFormat
+	}
+	rat, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return 0, ErrMoneyFormat
+	}
+	rat.Mul(rat, big.NewRat(MoneyScale, 1))
+	if !rat.IsInt() {
+		return 0, ErrMoneyPrecision
+	}
+	minor := rat.Num()
+	if !minor.IsInt64() {
+		return 0, ErrMoneyRange
+	}
+	return Money(minor.Int64()), nil
+}
+
+func RoundMoney(raw string) (Money, error) {
+	raw = strings.TrimSpace(raw)
+	if !roundedMoneyPattern.MatchString(raw) {
+		return 0, ErrMoneyFormat
+	}
+	rat, ok := new(big.Rat).SetString(raw)
+	if !ok {
+		return 0, ErrMoneyFormat
+	}
+	rat.Mul(rat, big.NewRat(MoneyScale, 1))
+	minor, rem := new(big.Int).QuoRem(new(big.Int).Abs(rat.Num()), rat.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(rat.Denom()) >= 0 {
+		minor.Add(minor, big.NewInt(1))
+	}
+	if rat.Sign() < 0 {
+		minor.Neg(minor)
+	}
+	if !minor.IsInt64() {
+		return 0, ErrMoneyRange
+	}
+	return Money(minor.Int64()), nil
+}
+
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+func (m Money) String() string {
+	sign, abs := "", uint64(m)
+	if m < 0 {
+		sign, abs = "-", uint64(-m)
+		if m == math.MinInt64 {
+			abs = uint64(math.MaxInt64) + 1
+		}
+	}
+	whole, frac := abs/MoneyScale, abs%MoneyScale
+	if frac == 0 {
+		return sign + strconv.FormatUint(whole, 10)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d", MoneyDecimals, frac), "0")
+	return sign + strconv.FormatUint(whole, 10) + "." + fracStr
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(raw)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch val := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(val)
+	case []byte:
+		parsed, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(parsed)
+	case string:
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(parsed)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
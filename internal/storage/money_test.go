@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Money
+		wantErr error
+	}{
+		{"0", 0, nil},
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"12.55", 1255, nil},
+		{"12.550", 1255, nil},
+		{" 7.01 ", 701, nil},
+		{"-3.2", -320, nil},
+		{"+3.2", 320, nil},
+		{"92233720368547758.07", math.MaxInt64, nil},
+		{"12.555", 0, ErrMoneyPrecision},
+		{"0.001", 0, ErrMoneyPrecision},
+		{"92233720368547758.08", 0, ErrMoneyRange},
+		{"", 0, ErrMoneyFormat},
+		{"abc", 0, ErrMoneyFormat},
+		{"1/4", 0, ErrMoneyFormat},
+		{"1e2", 0, ErrMoneyFormat},
+		{"1E-2", 0, ErrMoneyFormat},
+		{"0x10", 0, ErrMoneyFormat},
+		{"1.", 0, ErrMoneyFormat},
+		{".5", 0, ErrMoneyFormat},
+		{"1,5", 0, ErrMoneyFormat},
+		{"--1", 0, ErrMoneyFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseMoney(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Money
+		wantErr error
+	}{
+		{"729.98", 72998, nil},
+		{"729.987", 72999, nil},
+		{"729.984", 72998, nil},
+		{"0.005", 1, nil},
+		{"0.0049", 0, nil},
+		{"-0.005", -1, nil},
+		{"500", 50000, nil},
+		{"7.5e2", 75000, nil},
+		{"1E-3", 0, nil},
+		{"92233720368547758.07", math.MaxInt64, nil},
+		{"92233720368547758.075", 0, ErrMoneyRange},
+		{"1e400", 0, ErrMoneyFormat},
+		{"", 0, ErrMoneyFormat},
+		{"abc", 0, ErrMoneyFormat},
+		{"1/4", 0, ErrMoneyFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := RoundMoney(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RoundMoney(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RoundMoney(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{0, "0"},
+		{5, "0.05"},
+		{50, "0.5"},
+		{1200, "12"},
+		{1255, "12.55"},
+		{-320, "-3.2"},
+		{-5, "-0.05"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.want {
+				t.Errorf("Money(%d).String() = %q, want %q", int64(tt.money), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var payload struct {
+		Sum Money `json:"sum"`
+	}
+	if err := json.Unmarshal([]byte(`{"sum": 751.98}`), &payload); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if payload.Sum != 75198 {
+		t.Fatalf("Unmarshal() sum = %d, want 75198", payload.Sum)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"sum":751.98}` {
+		t.Errorf("Marshal() = %s", data)
+	}
+	if err = json.Unmarshal([]byte(`{"sum": 1e2}`), &payload); !errors.Is(err, ErrMoneyFormat) {
+		t.Errorf("Unmarshal() of exponent error = %v, want %v", err, ErrMoneyFormat)
+	}
+}
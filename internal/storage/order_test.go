@@ -0,0 +1,35 @@
+package storage
+
+import "testing"
+
+func TestOrderPendingAccrual(t *testing.T) {
+	tests := []struct {
+		name  string
+		order Order
+		want  Money
+	}{
+		{"new order with estimate", Order{Status: "NEW", Estimate: 1250}, 1250},
+		{"processing order without estimate", Order{Status: "PROCESSING"}, 0},
+		{"provisional accrual beats estimate", Order{Status: "PROCESSING", Accrual: 900, Estimate: 1250}, 900},
+		{"processed order is not pending", Order{Status: "PROCESSED", Accrual: 900, Estimate: 1250}, 0},
+		{"invalid order is not pending", Order{Status: "INVALID", Estimate: 1250}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.order.PendingAccrual(); got != tt.want {
+				t.Errorf("PendingAccrual() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPendingAccrualSum(t *testing.T) {
+	orders := []Order{
+		{Status: "NEW", Estimate: 1250},
+		{Status: "REGISTERED", Accrual: 300},
+		{Status: "PROCESSED", Accrual: 10000},
+	}
+	if got := PendingAccrual(orders); got != 1550 {
+		t.Errorf("PendingAccrual() = %s, want 15.5", got)
+	}
+}
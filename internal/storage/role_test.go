@@ -0,0 +1,22 @@
+package storage
+
+import "testing"
+
+func TestRoleValid(t *testing.T) {
+	tests := []struct {
+		role Role
+		want bool
+	}{
+		{RoleUser, true},
+		{RoleSupport, true},
+		{RoleAdmin, true},
+		{"", false},
+		{"Admin", false},
+		{"root", false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Valid(); got != tt.want {
+			t.Errorf("Role(%q).Valid() = %t, want %t", tt.role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemSessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Token
+	byToken  map[string]string
+	refresh  map[string]RefreshToken
+}
+
+func (m *MemSessionStore) IssueSession(token Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[token.ID] = token
+	if token.Token != "" {
+		m.byToken[token.Token] = token.ID
+	}
+	return nil
+}
+
+func (m *MemSessionStore) LookupSession(token string) (Token, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.byToken[token]
+	if !ok {
+		return Token{}, ErrSessionNotFound
+	}
+	return m.sessions[id], nil
+}
+
+func (m *MemSessionStore) LookupSessionByID(id string) (Token, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	val, ok := m.sessions[id]
+	if !ok {
+		return Token{}, ErrSessionNotFound
+	}
+	return val, nil
+}
+
+func (m *MemSessionStore) TouchSession(id string, lastSeen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	val.LastSeen = lastSeen
+	m.sessions[id] = val
+	return nil
+}
+
+func (m *MemSessionStore) RevokeSession(login string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.sessions[id]
+	if !ok || val.User != login {
+		return ErrSessionNotFound
+	}
+	m.deleteSession(val)
+	return nil
+}
+
+func (m *MemSessionStore) RevokeUserSessions(login string, exceptID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var revoked int64
+	for id, val := range m.sessions {
+		if val.User == login && id != exceptID {
+			m.deleteSession(val)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (m *MemSessionStore) GetUserSessions(login string) ([]Token, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var sessions []Token
+	for _, val := range m.sessions {
+		if val.User == login {
+			sessions = append(sessions, val)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Created.Equal(sessions[j].Created) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	return sessions, nil
+}
+
+func (m *MemSessionStore) ExpireSessions(lastSeenBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired int64
+	for _, val := range m.sessions {
+		if val.LastSeen.Before(lastSeenBefore) {
+			m.deleteSession(val)
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (m *MemSessionStore) deleteSession(session Token) {
+	delete(m.sessions, session.ID)
+	delete(m.byToken, session.Token)
+	for key, val := range m.refresh {
+		if val.Family == session.ID {
+			delete(m.refresh, key)
+		}
+	}
+}
+
+func (m *MemSessionStore) IssueRefreshToken(token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh[token.Token] = token
+	return nil
+}
+
+func (m *MemSessionStore) UseRefreshToken(token string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.refresh[token]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if val.Used {
+		return val, ErrRefreshTokenReused
+	}
+	val.Used = true
+	m.refresh[token] = val
+	return val, nil
+}
+
+func (m *MemSessionStore) RevokeRefreshFamily(family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, val := range m.refresh {
+		if val.Family == family {
+			delete(m.refresh, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemSessionStore) ExpireRefreshTokens(expiredBefore time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired int64
+	for key, val := range m.refresh {
+		if val.ExpiresAt.Before(expiredBefore) {
+			delete(m.refresh, key)
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func NewMemSessionStore() *MemSessionStore {
+	return &MemSessionStore{
+		sessions: make(map[string]Token),
+		byToken:  make(map[string]string),
+		refresh:  make(map[string]RefreshToken),
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemSessionStoreGetUserSessionsOrder(t *testing.T) {
+	store := NewMemSessionStore()
+	start := time.Now()
+	for i, id := range []string{"c", "a", "d", "b", "e"} {
+		created := start.Add(time.Duration(5-i) * time.Minute)
+		if id == "e" {
+			created = start.Add(2 * time.Minute)
+		}
+		if err := store.IssueSession(Token{ID: id, User: "gopher", Created: created}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.IssueSession(Token{ID: "other", User: "someone", Created: start}); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := store.GetUserSessions("gopher")
+	if err != nil {
+		t.Fatalf("GetUserSessions() error = %v", err)
+	}
+	var got []string
+	for _, session := range sessions {
+		got = append(got, session.ID)
+	}
+	want := []string{"b", "e", "d", "a", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("GetUserSessions() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("GetUserSessions() = %v, want %v", got, want)
+		}
+	}
+}
@@ -1,84 +1,449 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/HellfastUSMC/gophermart/internal/logger"
 )
 
 type Storage struct {
-	Logger logger.Logger
-	Tokens map[string]Token
+	Logger   logger.Logger
+	Sessions SessionStore
 	Connector
 }
 
+var (
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrRefreshTokenNotFound  = errors.New("refresh token not found")
+	ErrRefreshTokenReused    = errors.New("refresh token reused")
+	ErrResetTokenInvalid     = errors.New("password reset token is invalid or expired")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUnbalancedEntry       = errors.New("ledger entry postings are not balanced")
+	ErrInsufficientFunds     = errors.New("insufficient funds")
+	ErrDailyLimitExceeded    = errors.New("daily withdrawal limit exceeded")
+	ErrWithdrawalNotFound    = errors.New("withdrawal not found")
+	ErrAlreadyReversed       = errors.New("withdrawal already reversed")
+	ErrHoldNotFound          = errors.New("hold not found")
+	ErrHoldSettled           = errors.New("hold already captured or released")
+	ErrAccrualJobNotFound    = errors.New("accrual job not found")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrOrderAlreadyWithdrawn = errors.New("order already used for withdrawal")
+)
+
+const (
+	BonusAccrual    = "accrual"
+	BonusWithdrawal = "withdrawal"
+	BonusAdjustment = "adjustment"
+	BonusReversal   = "reversal"
+	BonusExpiration = "expiration"
+	BonusHold       = "hold"
+	BonusRelease    = "release"
+)
+
+const (
+	WithdrawalCompleted = "COMPLETED"
+	WithdrawalReversed  = "REVERSED"
+)
+
+const (
+	HoldHeld     = "HELD"
+	HoldCaptured = "CAPTURED"
+	HoldReleased = "RELEASED"
+)
+
+var AdjustmentReasons = map[string]struct{}{
+	"goodwill":       {},
+	"fraud_clawback": {},
+	"correction":     {},
+	"compensation":   {},
+}
+
+var ReversalReasons = map[string]struct{}{
+	"order_cancelled": {},
+	"refund":          {},
+	"correction":      {},
+}
+
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleSupport || r == RoleAdmin
+}
+
+type SessionStore interface {
+	IssueSession(token Token) error
+	LookupSession(token string) (Token, error)
+	LookupSessionByID(id string) (Token, error)
+	TouchSession(id string, lastSeen time.Time) error
+	RevokeSession(login string, id string) error
+	RevokeUserSessions(login string, exceptID string) (int64, error)
+	GetUserSessions(login string) ([]Token, error)
+	ExpireSessions(lastSeenBefore time.Time) (int64, error)
+	IssueRefreshToken(token RefreshToken) error
+	UseRefreshToken(token string) (RefreshToken, error)
+	RevokeRefreshFamily(family string) error
+	ExpireRefreshTokens(expiredBefore time.Time) (int64, error)
+}
+
 type Connector interface {
 	Close() error
 	Ping() error
 	UserOps
 	OrderOps
 	BonusOps
+	AttemptOps
+	ResetOps
+	IdempotencyOps
+	AccrualJobOps
 }
 
 type UserOps interface {
 	RegisterUser(login string, password string) (int64, error)
 	CheckUserCreds(login string, plainPassword string) (bool, error)
+	UserExists(login string) (bool, error)
+	UpdateUserPassword(login string, password string) (int64, error)
+	GetUser(login string) (User, error)
+	SetUserRole(login string, role Role) (int64, error)
+	SetUserBlocked(login string, blocked bool) (int64, error)
+	SearchUsers(query string, limit int64, offset int64) ([]User, error)
 	//GetUserBalance(login string) (float64, float64, error)
-	CheckUserBalance(userLogin string) (float64, float64, error)
-	UpdateUserBalance(checkUserBalance func(string) (float64, float64, error), userLogin string, sum float64, sub bool) (int64, error)
+	CheckUserBalance(userLogin string) (Money, Money, error)
+	GetPendingBalance(userLogin string) (Money, Money, error)
 }
 
 type OrderOps interface {
-	GetUserOrders(login string) ([]Order, error)
-	UpdateOrder(orderID string, accrual float64, status string) (int64, error)
-	RegisterOrder(orderID string, accrual float64, placedAt string, login string) (int64, error)
+	GetUserOrders(login string, filter OrderFilter) ([]Order, error)
+	RegisterOrder(orderID string, accrual Money, placedAt string, login string) (int64, error)
 	GetOrder(order string) (Order, error)
-	GetOrdersToCheck() ([]Order, error)
+	SetOrderEstimate(orderID string, estimate Money) (int64, error)
 }
 
 type BonusOps interface {
+	Withdraw(ctx context.Context, login string, order string, sum Money, dailyLimit Money) error
 	GetUserWithdrawals(login string) ([]Bonus, error)
-	RegisterBonusChange(orderID string, sum float64, placedAt string, login string, sub bool) (int64, error)
+	GetUserAdjustments(login string) ([]Adjustment, error)
+	ReverseWithdrawal(ctx context.Context, reversal Reversal) (Bonus, error)
+	GetUpcomingExpirations(login string, before time.Time) ([]Expiration, error)
+	ExpireLots(now time.Time) (int64, error)
+	HoldPoints(ctx context.Context, hold Hold) (Hold, error)
+	CaptureHold(ctx context.Context, id int64) (Hold, error)
+	ReleaseHold(ctx context.Context, id int64) (Hold, error)
+	ReleaseExpiredHolds(now time.Time) (int64, error)
+	GetUserHistory(login string, filter HistoryFilter) ([]HistoryEntry, error)
+	GetBalanceAt(login string, at time.Time) (Money, error)
+	StreamUserStatement(ctx context.Context, login string, from time.Time, to time.Time, fn func(row StatementRow) error) error
+	RegisterBalanceAdjustment(adjustment Adjustment) (int64, error)
+	ApplyAccrual(ctx context.Context, orderID string, status string, accrual Money) (Order, bool, error)
+	GetAccrualMismatches() ([]AccrualMismatch, error)
+}
+
+type AttemptOps interface {
+	GetLoginAttempts(subject string) (LoginAttempts, error)
+	RegisterLoginFailure(subject string, failedAt time.Time, resetAfter time.Duration) (int64, error)
+	BlockLoginAttempts(subject string, until time.Time) error
+	ResetLoginAttempts(subject string) error
+}
+
+type ResetOps interface {
+	IssuePasswordReset(reset PasswordReset) error
+	GetPasswordReset(token string, at time.Time) (PasswordReset, error)
+	UsePasswordReset(token string, usedAt time.Time, password string) (PasswordReset, error)
+}
+
+type IdempotencyOps interface {
+	ReserveIdempotencyKey(record IdempotencyRecord) (IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(record IdempotencyRecord) error
+	ReleaseIdempotencyKey(login string, key string) error
+	ExpireIdempotencyKeys(createdBefore time.Time) (int64, error)
+}
+
+type AccrualJobOps interface {
+	LeaseAccrualJobs(now time.Time, lease time.Duration, limit int64) ([]AccrualJob, error)
+	UpdateAccrualJob(job AccrualJob) error
+	GetAccrualJobs(dead bool, limit int64, offset int64) ([]AccrualJob, error)
+	RequeueAccrualJob(orderID string, now time.Time) (AccrualJob, error)
 }
 
 type Token struct {
-	Created time.Time
-	User    string
-	Token   string
+	ID        string
+	Created   time.Time
+	LastSeen  time.Time
+	User      string
+	Token     string
+	UserAgent string
+	IP        string
+}
+
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	Created   time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
+type RefreshToken struct {
+	Token     string
+	Family    string
+	User      string
+	Created   time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
+
+type TokenPair struct {
+	Token        string    `json:"Token"`
+	RefreshToken string    `json:"RefreshToken"`
+	ExpiresAt    time.Time `json:"ExpiresAt"`
 }
 
-func NewStorage(Logger logger.Logger, connector Connector) *Storage {
+func NewStorage(Logger logger.Logger, connector Connector, sessions SessionStore) *Storage {
 	return &Storage{
 		Logger:    Logger,
-		Tokens:    make(map[string]Token),
+		Sessions:  sessions,
 		Connector: connector,
 	}
 }
 
+type LoginAttempts struct {
+	Subject      string
+	Failures     int64
+	LastFailure  time.Time
+	BlockedUntil time.Time
+}
+
+type User struct {
+	Login   string `json:"login"`
+	Role    Role   `json:"role"`
+	Blocked bool   `json:"blocked"`
+}
+
+type UserDetails struct {
+	User        User         `json:"user"`
+	Balance     Balance      `json:"balance"`
+	Orders      []Order      `json:"orders"`
+	Withdrawals []Bonus      `json:"withdrawals"`
+	Adjustments []Adjustment `json:"adjustments"`
+}
+
 type UserCred struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
+type PasswordChange struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type PasswordResetRequest struct {
+	Login       string `json:"login"`
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type PasswordReset struct {
+	Token     string
+	Login     string
+	Created   time.Time
+	ExpiresAt time.Time
+}
+
 type Order struct {
-	ID      string  `json:"number"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual"`
-	Date    string  `json:"uploaded_at"`
-	Login   string  `json:"-"`
+	ID       string `json:"number"`
+	Status   string `json:"status"`
+	Accrual  Money  `json:"accrual"`
+	Estimate Money  `json:"estimated_accrual,omitempty"`
+	Date     string `json:"uploaded_at"`
+	Login    string `json:"-"`
+}
+
+func (o Order) PendingAccrual() Money {
+	if OrderFinal(o.Status) {
+		return 0
+	}
+	if o.Accrual > 0 {
+		return o.Accrual
+	}
+	return o.Estimate
+}
+
+func PendingAccrual(orders []Order) Money {
+	var pending Money
+	for _, order := range orders {
+		pending += order.PendingAccrual()
+	}
+	return pending
+}
+
+var OrderStatuses = map[string]struct{}{
+	"NEW":        {},
+	"REGISTERED": {},
+	"PROCESSING": {},
+	"INVALID":    {},
+	"PROCESSED":  {},
+}
+
+func OrderFinal(status string) bool {
+	return status == "PROCESSED" || status == "INVALID"
+}
+
+type OrderFilter struct {
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	Desc     bool
+	Limit    int64
+	After    *Cursor
+}
+
+var HistoryKinds = map[string]struct{}{
+	BonusAccrual:    {},
+	BonusWithdrawal: {},
+	BonusAdjustment: {},
+	BonusReversal:   {},
+	BonusExpiration: {},
+	BonusHold:       {},
+	BonusRelease:    {},
+}
+
+type HistoryFilter struct {
+	Kinds []string
+	From  time.Time
+	To    time.Time
+	Desc  bool
+	Limit int64
+	After *Cursor
+}
+
+type HistoryEntry struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"type"`
+	OrderID     string    `json:"order,omitempty"`
+	Amount      Money     `json:"amount"`
+	Balance     Money     `json:"balance"`
+	Captured    Money     `json:"captured,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+const (
+	StatementOrder = "order"
+	StatementEntry = "entry"
+)
+
+type StatementRow struct {
+	Record  string    `json:"record"`
+	Date    time.Time `json:"date"`
+	Type    string    `json:"type"`
+	OrderID string    `json:"order,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Accrual Money     `json:"accrual"`
+	Amount  Money     `json:"amount"`
+	Balance Money     `json:"balance"`
 }
 
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   Money        `json:"current"`
+	Withdrawn Money        `json:"withdrawn"`
+	Pending   Money        `json:"pending"`
+	Held      Money        `json:"held"`
+	Expiring  []Expiration `json:"expiring,omitempty"`
+}
+
+type Expiration struct {
+	Sum       Money     `json:"sum"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type Bonus struct {
-	ID          int64   `json:"-"`
-	OrderID     string  `json:"order"`
-	Sum         float64 `json:"sum"`
-	ProcessedAt string  `json:"processed_at"`
-	Login       string  `json:"-"`
+	ID          int64  `json:"-"`
+	OrderID     string `json:"order"`
+	Sum         Money  `json:"sum"`
+	ProcessedAt string `json:"processed_at"`
+	Status      string `json:"status"`
+	ReversedAt  string `json:"reversed_at,omitempty"`
+	Login       string `json:"-"`
+}
+
+type Hold struct {
+	ID        int64      `json:"id"`
+	Login     string     `json:"login"`
+	OrderID   string     `json:"order"`
+	Sum       Money      `json:"sum"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	SettledAt *time.Time `json:"settled_at,omitempty"`
+}
+
+const (
+	AccrualJobPending = "pending"
+	AccrualJobDead    = "dead"
+)
+
+type AccrualJob struct {
+	OrderID       string     `json:"order"`
+	Login         string     `json:"login"`
+	Status        string     `json:"status"`
+	PlacedAt      string     `json:"uploaded_at"`
+	Attempts      int64      `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeadAt        *time.Time `json:"dead_at,omitempty"`
+	State         string     `json:"state"`
+}
+
+func (j AccrualJob) Order() Order {
+	return Order{ID: j.OrderID, Login: j.Login, Status: j.Status, Date: j.PlacedAt}
+}
+
+type AccrualMismatch struct {
+	OrderID  string `json:"order"`
+	Login    string `json:"login"`
+	Status   string `json:"status"`
+	Accrual  Money  `json:"accrual"`
+	Credited Money  `json:"credited"`
+}
+
+type Reversal struct {
+	OrderID     string `json:"order"`
+	Reason      string `json:"reason"`
+	Note        string `json:"note"`
+	Actor       string `json:"actor"`
+	ProcessedAt string `json:"processed_at"`
+}
+
+type Adjustment struct {
+	ID          int64  `json:"-"`
+	Sum         Money  `json:"sum"`
+	Reason      string `json:"reason"`
+	Note        string `json:"note"`
+	Actor       string `json:"actor,omitempty"`
+	ProcessedAt string `json:"processed_at"`
+	Login       string `json:"-"`
+}
+
+type IdempotencyRecord struct {
+	Key         string
+	Login       string
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+	Created     time.Time
+	LockedUntil time.Time
 }
 
 type CurrentStats struct {
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"fmt"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -8,3 +11,7 @@ func PasswordHasher(plainPass string) ([]byte, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(plainPass), bcrypt.DefaultCost)
 	return bytes, err
 }
+
+func TokenHasher(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}